@@ -24,6 +24,8 @@ func main() {
 	}
 	//init DB
 	utils.InitDB()
+	//init object storage
+	utils.InitStorage()
 	log.Printf("Server running on port 8000")
 	log.Fatal(server.ListenAndServe())
 }
@@ -0,0 +1,328 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// accountForm maps the account payload accepted by AddAccount and UpdateAccount
+type accountForm struct {
+	Name            string          `json:"name"`
+	Broker          string          `json:"broker"`
+	BaseCurrency    string          `json:"baseCurrency"`
+	StartingBalance decimal.Decimal `json:"startingBalance"`
+	AccountType     string          `json:"accountType"`
+}
+
+// validate returns the error message for the first invalid field, or an
+// empty string when the form is valid
+func (data accountForm) validate() string {
+	if data.Name == "" {
+		return "Name is required"
+	}
+	if !currencyCodePattern.MatchString(data.BaseCurrency) {
+		return "BaseCurrency must be a 3 letter ISO currency code"
+	}
+	if data.StartingBalance.Sign() < 0 {
+		return "StartingBalance must not be negative"
+	}
+	if !slices.Contains([]string{models.AccountTypeLive, models.AccountTypePaper, models.AccountTypeProp}, data.AccountType) {
+		return "AccountType must be live, paper or prop"
+	}
+	return ""
+}
+
+// apply copies the form fields onto the account model
+func (data accountForm) apply(account *models.Account) {
+	account.Name = data.Name
+	account.Broker = data.Broker
+	account.BaseCurrency = data.BaseCurrency
+	account.StartingBalance = data.StartingBalance
+	account.AccountType = data.AccountType
+}
+
+// newAccountForm pre-populates a form from an existing account so partial
+// updates only overwrite the fields present in the payload
+func newAccountForm(account *models.Account) accountForm {
+	return accountForm{
+		Name:            account.Name,
+		Broker:          account.Broker,
+		BaseCurrency:    account.BaseCurrency,
+		StartingBalance: account.StartingBalance,
+		AccountType:     account.AccountType,
+	}
+}
+
+// AccountHandler dispatches /account to the handler for the request method
+func AccountHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ListAccounts(w, r)
+	case http.MethodPost:
+		AddAccount(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// AccountDetailHandler dispatches /account/{id} to the handler for the request method
+func AccountDetailHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		GetAccount(w, r)
+	case http.MethodPut, http.MethodPatch:
+		UpdateAccount(w, r)
+	case http.MethodDelete:
+		DeleteAccount(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// findUserAccount loads the account with the given AccountId owned by the
+// user. Accounts belonging to someone else are reported as not found.
+func findUserAccount(accountId string, userId string) (*models.Account, error) {
+	account := &models.Account{}
+	result := utils.DB.Where("account_id = ? AND user_id = ?", accountId, userId).First(account)
+	return account, result.Error
+}
+
+func ListAccounts(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+
+	var accounts []models.Account
+	result := utils.DB.Where("user_id = ?", userId).Order("created_at").Find(&accounts)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while listing accounts"})
+		return
+	}
+
+	serialized := make([]map[string]interface{}, 0, len(accounts))
+	for _, account := range accounts {
+		serialized = append(serialized, serializeAccount(account))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"accounts": serialized})
+}
+
+func AddAccount(w http.ResponseWriter, r *http.Request) {
+	// Accounts are live unless stated otherwise
+	data := accountForm{AccountType: models.AccountTypeLive}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+
+	// Validate required fields
+	if message := data.validate(); message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+
+	userId, _ := r.Context().Value("username").(string)
+	account := &models.Account{
+		AccountId: uuid.New().String(),
+		UserId:    userId,
+	}
+	data.apply(account)
+
+	result := utils.DB.Create(account)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while adding the account"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializeAccount(*account))
+}
+
+func GetAccount(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	account, err := findUserAccount(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Account not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the account"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serializeAccount(*account))
+}
+
+// UpdateAccount replaces the account on PUT and merges the payload into it on PATCH
+func UpdateAccount(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	account, err := findUserAccount(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Account not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the account"})
+		return
+	}
+
+	// PATCH starts from the stored values, PUT from an empty form
+	data := accountForm{AccountType: models.AccountTypeLive}
+	if r.Method == http.MethodPatch {
+		data = newAccountForm(account)
+	}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+
+	// Validate required fields
+	if message := data.validate(); message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+
+	// The trades and cash movements of the account are recorded in its base
+	// currency, so it cannot change once there are any
+	if data.BaseCurrency != account.BaseCurrency {
+		var tradeCount, entryCount int64
+		err := utils.DB.Model(&models.Trade{}).Where("account_id = ?", account.AccountId).Count(&tradeCount).Error
+		if err == nil {
+			err = utils.DB.Model(&models.LedgerEntry{}).Where("account_id = ?", account.AccountId).Count(&entryCount).Error
+		}
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while updating the account"})
+			return
+		}
+		if tradeCount > 0 || entryCount > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "BaseCurrency cannot change once the account has trades or ledger entries"})
+			return
+		}
+	}
+
+	data.apply(account)
+	result := utils.DB.Save(account)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while updating the account"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serializeAccount(*account))
+}
+
+// DeleteAccount soft deletes an account along with its ledger. Accounts that
+// still own trades cannot be deleted so no trade is left pointing at a
+// missing account.
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	account, err := findUserAccount(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Account not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the account"})
+		return
+	}
+
+	var tradeCount int64
+	result := utils.DB.Model(&models.Trade{}).Where("account_id = ?", account.AccountId).Count(&tradeCount)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while deleting the account"})
+		return
+	}
+	if tradeCount > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Account still has trades"})
+		return
+	}
+
+	// Cash movements go with the account
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("account_id = ?", account.AccountId).Delete(&models.LedgerEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(account).Error
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while deleting the account"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serializeAccount builds the JSON representation of an account returned by the API
+func serializeAccount(account models.Account) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              account.AccountId,
+		"name":            account.Name,
+		"broker":          account.Broker,
+		"baseCurrency":    account.BaseCurrency,
+		"startingBalance": account.StartingBalance,
+		"accountType":     account.AccountType,
+		"createdAt":       account.CreatedAt,
+		"updatedAt":       account.UpdatedAt,
+	}
+}
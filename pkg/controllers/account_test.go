@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+// createTestAccount stores a USD account of the user, creating the user first
+// when needed
+func createTestAccount(t *testing.T, accountId string, userId string) {
+	t.Helper()
+	createTestUser(t, userId)
+	account := &models.Account{
+		AccountId:       accountId,
+		UserId:          userId,
+		Name:            "Main",
+		BaseCurrency:    "USD",
+		StartingBalance: decimal.NewFromInt(10000),
+		AccountType:     models.AccountTypeLive,
+	}
+	if err := utils.DB.Create(account).Error; err != nil {
+		t.Fatalf("creating account %s: %v", accountId, err)
+	}
+}
+
+// serveAccount runs AccountDetailHandler on the account for the user and
+// returns the response status and body
+func serveAccount(t *testing.T, method string, userId string, accountId string, body string) (int, string) {
+	t.Helper()
+	r := asUser(httptest.NewRequest(method, "/account/"+accountId, strings.NewReader(body)), userId)
+	r.SetPathValue("id", accountId)
+	w := httptest.NewRecorder()
+	AccountDetailHandler(w, r)
+	return w.Code, w.Body.String()
+}
+
+func TestAccountFormValidate(t *testing.T) {
+	valid := accountForm{Name: "Main", BaseCurrency: "USD", StartingBalance: decimal.NewFromInt(10000), AccountType: models.AccountTypeLive}
+	tests := []struct {
+		name    string
+		edit    func(data *accountForm)
+		message string
+	}{
+		{"valid", func(data *accountForm) {}, ""},
+		{"missing name", func(data *accountForm) { data.Name = "" }, "Name is required"},
+		{"lowercase currency", func(data *accountForm) { data.BaseCurrency = "usd" }, "BaseCurrency must be a 3 letter ISO currency code"},
+		{"negative balance", func(data *accountForm) { data.StartingBalance = decimal.NewFromInt(-1) }, "StartingBalance must not be negative"},
+		{"unknown type", func(data *accountForm) { data.AccountType = "demo" }, "AccountType must be live, paper or prop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := valid
+			tt.edit(&data)
+			if message := data.validate(); message != tt.message {
+				t.Errorf("validate() = %q, want %q", message, tt.message)
+			}
+		})
+	}
+}
+
+func TestUpdateAccountBaseCurrency(t *testing.T) {
+	useTestDB(t)
+	createTestAccount(t, "account-1", "alice")
+	createTestAccount(t, "account-2", "alice")
+	createTestTrade(t, "trade-1", "alice")
+	if err := utils.DB.Model(&models.Trade{}).Where("trad_id = ?", "trade-1").Update("account_id", "account-1").Error; err != nil {
+		t.Fatalf("assigning the trade: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		userId    string
+		accountId string
+		body      string
+		status    int
+	}{
+		{"another user", "bob", "account-2", `{"baseCurrency": "EUR"}`, http.StatusNotFound},
+		{"account with trades", "alice", "account-1", `{"baseCurrency": "EUR"}`, http.StatusConflict},
+		{"same currency on an account with trades", "alice", "account-1", `{"name": "Renamed", "baseCurrency": "USD"}`, http.StatusOK},
+		{"account without trades", "alice", "account-2", `{"baseCurrency": "EUR"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := serveAccount(t, http.MethodPatch, tt.userId, tt.accountId, tt.body)
+			if code != tt.status {
+				t.Errorf("UpdateAccount() status = %d, want %d: %s", code, tt.status, body)
+			}
+		})
+	}
+
+	// Cash movements are recorded in the base currency too
+	entry := &models.LedgerEntry{EntryId: "entry-1", AccountId: "account-2", UserId: "alice", EntryType: models.LedgerEntryDeposit, Amount: decimal.NewFromInt(500), OccurredAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+	if err := utils.DB.Create(entry).Error; err != nil {
+		t.Fatalf("creating the ledger entry: %v", err)
+	}
+	if code, body := serveAccount(t, http.MethodPatch, "alice", "account-2", `{"baseCurrency": "GBP"}`); code != http.StatusConflict {
+		t.Errorf("UpdateAccount() of an account with ledger entries status = %d, want %d: %s", code, http.StatusConflict, body)
+	}
+
+	var currencies []string
+	utils.DB.Model(&models.Account{}).Order("account_id").Pluck("base_currency", &currencies)
+	if strings.Join(currencies, ",") != "USD,EUR" {
+		t.Errorf("base currencies = %v, want [USD EUR]", currencies)
+	}
+}
+
+func TestDeleteAccountWithTrades(t *testing.T) {
+	useTestDB(t)
+	createTestAccount(t, "account-1", "alice")
+	createTestTrade(t, "trade-1", "alice")
+	if err := utils.DB.Model(&models.Trade{}).Where("trad_id = ?", "trade-1").Update("account_id", "account-1").Error; err != nil {
+		t.Fatalf("assigning the trade: %v", err)
+	}
+
+	if code, body := serveAccount(t, http.MethodDelete, "alice", "account-1", ""); code != http.StatusConflict {
+		t.Errorf("DeleteAccount() status = %d, want %d: %s", code, http.StatusConflict, body)
+	}
+	if err := utils.DB.Model(&models.Trade{}).Where("trad_id = ?", "trade-1").Update("account_id", "").Error; err != nil {
+		t.Fatalf("unassigning the trade: %v", err)
+	}
+	if code, body := serveAccount(t, http.MethodDelete, "alice", "account-1", ""); code != http.StatusNoContent {
+		t.Errorf("DeleteAccount() status = %d, want %d: %s", code, http.StatusNoContent, body)
+	}
+
+	var response map[string]interface{}
+	code, body := serveAccount(t, http.MethodGet, "alice", "account-1", "")
+	if code != http.StatusNotFound || json.Unmarshal([]byte(body), &response) != nil || response["error"] != "Account not found" {
+		t.Errorf("GetAccount() of a deleted account = %d %s, want not found", code, body)
+	}
+}
@@ -0,0 +1,379 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// GetRStats aggregates the R-multiples of the caller's closed trades that
+// have a defined initial risk. It accepts the same filters as ListTrades and
+// a bucketSize for the R distribution, 1R by default.
+func GetRStats(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	query := r.URL.Query()
+
+	bucketSize := decimal.NewFromInt(1)
+	if bucketParam := query.Get("bucketSize"); bucketParam != "" {
+		parsed, err := decimal.NewFromString(bucketParam)
+		if err != nil || !parsed.IsPositive() {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "bucketSize must be greater than 0"})
+			return
+		}
+		bucketSize = parsed
+	}
+
+	tx, message := filterUserTrades(userId, query)
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+	tx = tx.Where("status = ? AND r_multiple IS NOT NULL", models.TradeStatusClosed)
+
+	var summary struct {
+		TradeCount int64
+		TotalR     decimal.Decimal
+		AverageR   decimal.NullDecimal
+		BestR      decimal.NullDecimal
+		WorstR     decimal.NullDecimal
+	}
+	result := tx.Select("COUNT(*) AS trade_count, COALESCE(SUM(r_multiple), 0) AS total_r, ROUND(AVG(r_multiple), 8) AS average_r, MAX(r_multiple) AS best_r, MIN(r_multiple) AS worst_r").Scan(&summary)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing R statistics"})
+		return
+	}
+
+	var buckets []struct {
+		Bucket     decimal.Decimal
+		TradeCount int64
+	}
+	result = tx.Select("FLOOR(r_multiple / ?) * ? AS bucket, COUNT(*) AS trade_count", bucketSize, bucketSize).Group("bucket").Order("bucket").Scan(&buckets)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing R statistics"})
+		return
+	}
+
+	distribution := make([]map[string]interface{}, 0, len(buckets))
+	for _, bucket := range buckets {
+		distribution = append(distribution, map[string]interface{}{
+			"from":       bucket.Bucket,
+			"to":         bucket.Bucket.Add(bucketSize),
+			"tradeCount": bucket.TradeCount,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tradeCount":   summary.TradeCount,
+		"totalR":       summary.TotalR,
+		"averageR":     summary.AverageR,
+		"bestR":        summary.BestR,
+		"worstR":       summary.WorstR,
+		"distribution": distribution,
+	})
+}
+
+// GetTagStats breaks the performance of the caller's closed trades down per
+// tag. It accepts the same filters as ListTrades and a kind to restrict the
+// breakdown to plain tags, strategies or mistakes. A trade carrying several
+// tags counts towards each of them.
+func GetTagStats(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	query := r.URL.Query()
+
+	tx, message := filterUserTrades(userId, query)
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+	tx = tx.Joins("JOIN trade_tags ON trade_tags.trad_id = trades.trad_id").
+		Joins("JOIN tags ON tags.tag_id = trade_tags.tag_id AND tags.deleted_at IS NULL").
+		Where("trades.status = ?", models.TradeStatusClosed)
+	if kind := query.Get("kind"); kind != "" {
+		tx = tx.Where("tags.kind = ?", kind)
+	}
+
+	var rows []struct {
+		TagId      string
+		Kind       string
+		Name       string
+		TradeCount int64
+		WinCount   int64
+		GrossPnl   decimal.Decimal
+		NetPnl     decimal.Decimal
+		AverageR   decimal.NullDecimal
+	}
+	result := tx.Select(`tags.tag_id, tags.kind, tags.name, COUNT(*) AS trade_count,
+		COUNT(*) FILTER (WHERE trades.net_pnl > 0) AS win_count,
+		SUM(trades.realized_pnl) AS gross_pnl, SUM(trades.net_pnl) AS net_pnl,
+		ROUND(AVG(trades.r_multiple), 8) AS average_r`).
+		Group("tags.tag_id, tags.kind, tags.name").Order("net_pnl DESC").Scan(&rows)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing tag statistics"})
+		return
+	}
+
+	breakdown := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		breakdown = append(breakdown, map[string]interface{}{
+			"tagId":      row.TagId,
+			"kind":       row.Kind,
+			"name":       row.Name,
+			"tradeCount": row.TradeCount,
+			"winRate":    decimal.NewFromInt(row.WinCount).Div(decimal.NewFromInt(row.TradeCount)).Shift(2).Round(models.PercentScale),
+			"grossPnl":   row.GrossPnl,
+			"netPnl":     row.NetPnl,
+			"averageR":   row.AverageR,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"tags": breakdown})
+}
+
+// psychologyRatings are the rating columns of a trade broken down by
+// GetPsychologyStats, keyed by their name in the API
+var psychologyRatings = []struct {
+	key    string
+	column string
+}{
+	{"confidence", "trades.confidence"},
+	{"emotionBefore", "trades.emotion_before"},
+	{"emotionAfter", "trades.emotion_after"},
+	{"discipline", "trades.discipline"},
+}
+
+// GetPsychologyStats relates the psychology ratings and mistakes of the
+// caller's closed trades to their outcome. Every rating gets its Pearson
+// correlation with the net P&L and with winning, and the performance of
+// the trades at each score. Trades with and without mistakes are compared;
+// /stats/tags?kind=mistake breaks them down per mistake. It accepts the
+// same filters as ListTrades.
+func GetPsychologyStats(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+
+	tx, message := filterUserTrades(userId, r.URL.Query())
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+	// Every query below adds its own conditions to the closed trades
+	tx = tx.Where("trades.status = ?", models.TradeStatusClosed).Session(&gorm.Session{})
+
+	ratings := map[string]interface{}{}
+	for _, rating := range psychologyRatings {
+		var summary struct {
+			TradeCount         int64
+			PnlCorrelation     decimal.NullDecimal
+			WinRateCorrelation decimal.NullDecimal
+		}
+		result := tx.Where(rating.column + " IS NOT NULL").
+			Select(`COUNT(*) AS trade_count,
+				ROUND(corr(` + rating.column + `, trades.net_pnl::float8)::numeric, 8) AS pnl_correlation,
+				ROUND(corr(` + rating.column + `, CASE WHEN trades.net_pnl > 0 THEN 1 ELSE 0 END)::numeric, 8) AS win_rate_correlation`).
+			Scan(&summary)
+		if result.Error != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing psychology statistics"})
+			return
+		}
+
+		var scores []struct {
+			Score      int
+			TradeCount int64
+			WinCount   int64
+			NetPnl     decimal.Decimal
+			AverageR   decimal.NullDecimal
+		}
+		result = tx.Where(rating.column + " IS NOT NULL").
+			Select(rating.column + ` AS score, COUNT(*) AS trade_count,
+				COUNT(*) FILTER (WHERE trades.net_pnl > 0) AS win_count,
+				SUM(trades.net_pnl) AS net_pnl, ROUND(AVG(trades.r_multiple), 8) AS average_r`).
+			Group("score").Order("score").Scan(&scores)
+		if result.Error != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing psychology statistics"})
+			return
+		}
+
+		breakdown := make([]map[string]interface{}, 0, len(scores))
+		for _, score := range scores {
+			breakdown = append(breakdown, map[string]interface{}{
+				"score":         score.Score,
+				"tradeCount":    score.TradeCount,
+				"winRate":       decimal.NewFromInt(score.WinCount).Div(decimal.NewFromInt(score.TradeCount)).Shift(2).Round(models.PercentScale),
+				"netPnl":        score.NetPnl,
+				"averageNetPnl": score.NetPnl.Div(decimal.NewFromInt(score.TradeCount)).Round(models.MoneyScale),
+				"averageR":      score.AverageR,
+			})
+		}
+		ratings[rating.key] = map[string]interface{}{
+			"tradeCount":         summary.TradeCount,
+			"pnlCorrelation":     summary.PnlCorrelation,
+			"winRateCorrelation": summary.WinRateCorrelation,
+			"scores":             breakdown,
+		}
+	}
+
+	var groups []struct {
+		HasMistakes bool
+		TradeCount  int64
+		WinCount    int64
+		NetPnl      decimal.Decimal
+		AverageR    decimal.NullDecimal
+	}
+	result := tx.Select(`EXISTS (SELECT 1 FROM trade_tags
+			JOIN tags ON tags.tag_id = trade_tags.tag_id AND tags.deleted_at IS NULL
+			WHERE trade_tags.trad_id = trades.trad_id AND tags.kind = ?) AS has_mistakes,
+		COUNT(*) AS trade_count, COUNT(*) FILTER (WHERE trades.net_pnl > 0) AS win_count,
+		SUM(trades.net_pnl) AS net_pnl, ROUND(AVG(trades.r_multiple), 8) AS average_r`, models.TagKindMistake).
+		Group("has_mistakes").Scan(&groups)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing psychology statistics"})
+		return
+	}
+
+	mistakes := map[string]interface{}{"withMistakes": nil, "withoutMistakes": nil}
+	for _, group := range groups {
+		key := "withoutMistakes"
+		if group.HasMistakes {
+			key = "withMistakes"
+		}
+		mistakes[key] = map[string]interface{}{
+			"tradeCount": group.TradeCount,
+			"winRate":    decimal.NewFromInt(group.WinCount).Div(decimal.NewFromInt(group.TradeCount)).Shift(2).Round(models.PercentScale),
+			"netPnl":     group.NetPnl,
+			"averageR":   group.AverageR,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ratings":  ratings,
+		"mistakes": mistakes,
+	})
+}
+
+// GetSummaryStats returns the headline performance figures of the caller's
+// closed trades, aggregated by the database. Wins and losses are told apart
+// by net P&L. Ratios whose denominator is zero, such as the profit factor
+// without any loss, are null. It accepts the same filters as ListTrades.
+func GetSummaryStats(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+
+	tx, message := filterUserTrades(userId, r.URL.Query())
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+
+	var summary struct {
+		TradeCount     int64
+		WinCount       int64
+		LossCount      int64
+		BreakevenCount int64
+		GrossPnl       decimal.Decimal
+		TotalCosts     decimal.Decimal
+		NetPnl         decimal.Decimal
+		GrossProfit    decimal.Decimal
+		GrossLoss      decimal.Decimal
+		AverageWin     decimal.NullDecimal
+		AverageLoss    decimal.NullDecimal
+		LargestWin     decimal.NullDecimal
+		LargestLoss    decimal.NullDecimal
+	}
+	result := tx.Where("trades.status = ?", models.TradeStatusClosed).
+		Select(`COUNT(*) AS trade_count,
+			COUNT(*) FILTER (WHERE trades.net_pnl > 0) AS win_count,
+			COUNT(*) FILTER (WHERE trades.net_pnl < 0) AS loss_count,
+			COUNT(*) FILTER (WHERE trades.net_pnl = 0) AS breakeven_count,
+			COALESCE(SUM(trades.realized_pnl), 0) AS gross_pnl,
+			COALESCE(SUM(trades.commission + trades.fees + trades.swap + trades.funding + trades.execution_fees), 0) AS total_costs,
+			COALESCE(SUM(trades.net_pnl), 0) AS net_pnl,
+			COALESCE(SUM(trades.net_pnl) FILTER (WHERE trades.net_pnl > 0), 0) AS gross_profit,
+			COALESCE(-SUM(trades.net_pnl) FILTER (WHERE trades.net_pnl < 0), 0) AS gross_loss,
+			ROUND(AVG(trades.net_pnl) FILTER (WHERE trades.net_pnl > 0), 18) AS average_win,
+			ROUND(AVG(trades.net_pnl) FILTER (WHERE trades.net_pnl < 0), 18) AS average_loss,
+			MAX(trades.net_pnl) FILTER (WHERE trades.net_pnl > 0) AS largest_win,
+			MIN(trades.net_pnl) FILTER (WHERE trades.net_pnl < 0) AS largest_loss`).
+		Scan(&summary)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing summary statistics"})
+		return
+	}
+
+	var winRate, expectancy, profitFactor, payoffRatio decimal.NullDecimal
+	if summary.TradeCount > 0 {
+		tradeCount := decimal.NewFromInt(summary.TradeCount)
+		winRate = decimal.NewNullDecimal(decimal.NewFromInt(summary.WinCount).Div(tradeCount).Shift(2).Round(models.PercentScale))
+		expectancy = decimal.NewNullDecimal(summary.NetPnl.Div(tradeCount).Round(models.MoneyScale))
+	}
+	if summary.GrossLoss.IsPositive() {
+		profitFactor = decimal.NewNullDecimal(summary.GrossProfit.Div(summary.GrossLoss).Round(models.PercentScale))
+	}
+	if summary.AverageWin.Valid && summary.AverageLoss.Valid {
+		payoffRatio = decimal.NewNullDecimal(summary.AverageWin.Decimal.Div(summary.AverageLoss.Decimal.Abs()).Round(models.PercentScale))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tradeCount":     summary.TradeCount,
+		"winCount":       summary.WinCount,
+		"lossCount":      summary.LossCount,
+		"breakevenCount": summary.BreakevenCount,
+		"winRate":        winRate,
+		"grossPnl":       summary.GrossPnl,
+		"totalCosts":     summary.TotalCosts,
+		"netPnl":         summary.NetPnl,
+		"grossProfit":    summary.GrossProfit,
+		"grossLoss":      summary.GrossLoss,
+		"profitFactor":   profitFactor,
+		"expectancy":     expectancy,
+		"averageWin":     summary.AverageWin,
+		"averageLoss":    summary.AverageLoss,
+		"largestWin":     summary.LargestWin,
+		"largestLoss":    summary.LargestLoss,
+		"payoffRatio":    payoffRatio,
+	})
+}
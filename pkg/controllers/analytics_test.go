@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+func TestGetRStats(t *testing.T) {
+	useTestDB(t)
+	rMultiples := map[string]string{"trade-1": "1.5", "trade-2": "-1", "trade-3": "2.5", "trade-4": ""}
+	for tradeId, rMultiple := range rMultiples {
+		createTestTrade(t, tradeId, "alice")
+		updates := map[string]interface{}{"status": models.TradeStatusClosed}
+		if rMultiple != "" {
+			updates["r_multiple"] = decimal.RequireFromString(rMultiple)
+		}
+		if err := utils.DB.Model(&models.Trade{}).Where("trad_id = ?", tradeId).Updates(updates).Error; err != nil {
+			t.Fatalf("closing %s: %v", tradeId, err)
+		}
+	}
+	// Open trades have no R-multiple yet and other users' trades are not counted
+	createTestTrade(t, "trade-5", "alice")
+	createTestTrade(t, "trade-6", "bob")
+	if err := utils.DB.Model(&models.Trade{}).Where("trad_id = ?", "trade-6").Updates(map[string]interface{}{"status": models.TradeStatusClosed, "r_multiple": decimal.NewFromInt(3)}).Error; err != nil {
+		t.Fatalf("closing trade-6: %v", err)
+	}
+
+	r := asUser(httptest.NewRequest(http.MethodGet, "/stats/r", nil), "alice")
+	w := httptest.NewRecorder()
+	GetRStats(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GetRStats() status = %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		TradeCount   int64
+		TotalR       decimal.Decimal
+		AverageR     decimal.Decimal
+		BestR        decimal.Decimal
+		WorstR       decimal.Decimal
+		Distribution []struct {
+			From       decimal.Decimal
+			TradeCount int64
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+	}
+	if response.TradeCount != 3 || !response.TotalR.Equal(decimal.NewFromInt(3)) || !response.AverageR.Equal(decimal.NewFromInt(1)) || !response.BestR.Equal(decimal.RequireFromString("2.5")) || !response.WorstR.Equal(decimal.NewFromInt(-1)) {
+		t.Errorf("GetRStats() = %s, want 3 trades totalling 3R", w.Body.String())
+	}
+	buckets := []int64{-1, 1, 2}
+	if len(response.Distribution) != len(buckets) {
+		t.Fatalf("distribution = %v, want buckets from %v", response.Distribution, buckets)
+	}
+	for i, from := range buckets {
+		if !response.Distribution[i].From.Equal(decimal.NewFromInt(from)) || response.Distribution[i].TradeCount != 1 {
+			t.Errorf("distribution[%d] = %v, want one trade from %dR", i, response.Distribution[i], from)
+		}
+	}
+
+	for _, bucketSize := range []string{"0", "-1", "abc"} {
+		r := asUser(httptest.NewRequest(http.MethodGet, "/stats/r?bucketSize="+bucketSize, nil), "alice")
+		w := httptest.NewRecorder()
+		GetRStats(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GetRStats() with bucketSize %s status = %d, want %d", bucketSize, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestGetSummaryStats(t *testing.T) {
+	useTestDB(t)
+	closedTrades := []struct {
+		tradeId string
+		updates map[string]interface{}
+	}{
+		{"trade-1", map[string]interface{}{"realized_pnl": 100, "commission": 5, "execution_fees": 3, "net_pnl": 92}},
+		{"trade-2", map[string]interface{}{"realized_pnl": -40, "fees": 2, "net_pnl": -42}},
+		{"trade-3", map[string]interface{}{"realized_pnl": 0, "net_pnl": 0}},
+		{"trade-4", map[string]interface{}{"realized_pnl": 59, "swap": 1, "net_pnl": 58}},
+	}
+	for _, trade := range closedTrades {
+		createTestTrade(t, trade.tradeId, "alice")
+		trade.updates["status"] = models.TradeStatusClosed
+		if err := utils.DB.Model(&models.Trade{}).Where("trad_id = ?", trade.tradeId).Updates(trade.updates).Error; err != nil {
+			t.Fatalf("closing %s: %v", trade.tradeId, err)
+		}
+	}
+	// Open trades and other users' trades are not counted
+	createTestTrade(t, "trade-5", "alice")
+	createTestTrade(t, "trade-6", "bob")
+	if err := utils.DB.Model(&models.Trade{}).Where("trad_id = ?", "trade-6").Updates(map[string]interface{}{"status": models.TradeStatusClosed, "net_pnl": 500}).Error; err != nil {
+		t.Fatalf("closing trade-6: %v", err)
+	}
+
+	summary := func(userId string) map[string]interface{} {
+		t.Helper()
+		r := asUser(httptest.NewRequest(http.MethodGet, "/stats/summary", nil), userId)
+		w := httptest.NewRecorder()
+		GetSummaryStats(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GetSummaryStats() status = %d: %s", w.Code, w.Body.String())
+		}
+		var response map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+		}
+		return response
+	}
+
+	response := summary("alice")
+	want := map[string]string{
+		"tradeCount": "4", "winCount": "2", "lossCount": "1", "breakevenCount": "1", "winRate": "50",
+		"grossPnl": "119", "totalCosts": "11", "netPnl": "108", "grossProfit": "150", "grossLoss": "42",
+		"profitFactor": "3.57142857", "expectancy": "27", "averageWin": "75", "averageLoss": "-42",
+		"largestWin": "92", "largestLoss": "-42", "payoffRatio": "1.78571429",
+	}
+	for field, value := range want {
+		got, err := decimal.NewFromString(fmt.Sprint(response[field]))
+		if err != nil || !got.Equal(decimal.RequireFromString(value)) {
+			t.Errorf("%s = %v, want %s", field, response[field], value)
+		}
+	}
+
+	// Ratios over nothing are null
+	response = summary("carol")
+	for _, field := range []string{"winRate", "expectancy", "profitFactor", "averageWin", "averageLoss", "payoffRatio"} {
+		if response[field] != nil {
+			t.Errorf("%s = %v without trades, want null", field, response[field])
+		}
+	}
+	if response["tradeCount"] != float64(0) || response["netPnl"] != "0" {
+		t.Errorf("GetSummaryStats() without trades = %v, want zero totals", response)
+	}
+}
@@ -0,0 +1,354 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// uploadURLLifetime is how long a client has to start an upload
+	uploadURLLifetime = 15 * 60
+	// downloadURLLifetime is kept short since anyone holding the URL can
+	// read the file
+	downloadURLLifetime = 5 * 60
+	maxAttachmentSize   = 10 << 20
+)
+
+// attachmentContentTypes are the content types accepted for attachments and
+// the file extension their objects are stored with
+var attachmentContentTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// AttachmentsHandler dispatches /trade/{id}/attachments to the handler for
+// the request method
+func AttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ListAttachments(w, r)
+	case http.MethodPost:
+		AddAttachment(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// AttachmentDetailHandler dispatches /trade/{id}/attachments/{attachmentId}
+// to the handler for the request method
+func AttachmentDetailHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		GetAttachment(w, r)
+	case http.MethodDelete:
+		DeleteAttachment(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// attachmentObjectKey builds the object key of an attachment. Every key sits
+// under the prefix of the user who owns it.
+func attachmentObjectKey(userId string, tradeId string, attachmentId string, contentType string) string {
+	return fmt.Sprintf("users/%s/trades/%s/attachments/%s%s", userId, tradeId, attachmentId, attachmentContentTypes[contentType])
+}
+
+// findUserAttachment loads an attachment of one of the user's trades
+func findUserAttachment(tradeId string, attachmentId string, userId string) (*models.Attachment, error) {
+	attachment := &models.Attachment{}
+	result := utils.DB.Where("attachment_id = ? AND trad_id = ? AND user_id = ?", attachmentId, tradeId, userId).First(attachment)
+	return attachment, result.Error
+}
+
+// ListAttachments returns the uploaded attachments of a trade, each with a
+// short lived download URL
+func ListAttachments(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+
+	var attachments []models.Attachment
+	result := utils.DB.Where("trad_id = ? AND user_id = ? AND status = ?", trade.TradId, userId, models.AttachmentStatusUploaded).Order("uploaded_at, id").Find(&attachments)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while listing attachments"})
+		return
+	}
+
+	serialized := make([]map[string]interface{}, 0, len(attachments))
+	for _, attachment := range attachments {
+		url, err := utils.Storage.GenerateGetURL(r.Context(), utils.StorageBucket, attachment.ObjectKey, downloadURLLifetime)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while listing attachments"})
+			return
+		}
+		serialized = append(serialized, serializeAttachment(attachment, url))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"attachments": serialized, "urlExpiresIn": downloadURLLifetime})
+}
+
+// AddAttachment reserves an upload slot for a trade. The response carries a
+// presigned URL the client PUTs the file to with the announced Content-Type,
+// after which the upload is confirmed with ConfirmAttachment.
+func AddAttachment(w http.ResponseWriter, r *http.Request) {
+	type FormData struct {
+		FileName    string `json:"fileName"`
+		ContentType string `json:"contentType"`
+	}
+
+	var data FormData
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+
+	// Validate required fields
+	if _, ok := attachmentContentTypes[data.ContentType]; !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Content type must be one of image/png, image/jpeg, image/gif or image/webp"})
+		return
+	}
+	// Only the base name is kept, the object key never depends on it
+	fileName := path.Base(strings.ReplaceAll(data.FileName, "\\", "/"))
+	if data.FileName == "" || fileName == "." || fileName == "/" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "File name is required"})
+		return
+	}
+
+	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+
+	attachmentId := uuid.New().String()
+	attachment := &models.Attachment{
+		AttachmentId: attachmentId,
+		UserId:       userId,
+		TradId:       trade.TradId,
+		ObjectKey:    attachmentObjectKey(userId, trade.TradId, attachmentId, data.ContentType),
+		FileName:     fileName,
+		ContentType:  data.ContentType,
+		Status:       models.AttachmentStatusPending,
+	}
+	uploadURL, err := utils.Storage.GeneratePutURL(r.Context(), utils.StorageBucket, attachment.ObjectKey, uploadURLLifetime)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while adding the attachment"})
+		return
+	}
+	result := utils.DB.Create(attachment)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while adding the attachment"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"attachment":   serializeAttachment(*attachment, ""),
+		"uploadUrl":    uploadURL,
+		"urlExpiresIn": uploadURLLifetime,
+	})
+}
+
+// ConfirmAttachment marks an attachment as uploaded once its object is found
+// in storage. Uploads that are too large or of another content type than
+// announced are removed and rejected.
+func ConfirmAttachment(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	attachment, err := findUserAttachment(r.PathValue("id"), r.PathValue("attachmentId"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Attachment not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the attachment"})
+		return
+	}
+
+	// Confirming twice is harmless
+	if attachment.Status != models.AttachmentStatusUploaded {
+		info, err := utils.Storage.HeadObject(r.Context(), utils.StorageBucket, attachment.ObjectKey)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			if errors.Is(err, utils.ErrObjectNotFound) {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(map[string]string{"error": "The file has not been uploaded yet"})
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while confirming the attachment"})
+			return
+		}
+		if info.Size > maxAttachmentSize || info.ContentType != attachment.ContentType {
+			utils.Storage.DeleteObject(r.Context(), utils.StorageBucket, attachment.ObjectKey)
+			utils.DB.Unscoped().Delete(attachment)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Attachments must be %s files of at most %d MB", attachment.ContentType, maxAttachmentSize>>20)})
+			return
+		}
+
+		uploadedAt := time.Now()
+		attachment.Size = info.Size
+		attachment.Status = models.AttachmentStatusUploaded
+		attachment.UploadedAt = &uploadedAt
+		result := utils.DB.Save(attachment)
+		if result.Error != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while confirming the attachment"})
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serializeAttachment(*attachment, ""))
+}
+
+// GetAttachment returns an uploaded attachment with a fresh download URL
+func GetAttachment(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	attachment, err := findUserAttachment(r.PathValue("id"), r.PathValue("attachmentId"), userId)
+	if err == nil && attachment.Status != models.AttachmentStatusUploaded {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Attachment not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the attachment"})
+		return
+	}
+
+	url, err := utils.Storage.GenerateGetURL(r.Context(), utils.StorageBucket, attachment.ObjectKey, downloadURLLifetime)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the attachment"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"attachment": serializeAttachment(*attachment, url), "urlExpiresIn": downloadURLLifetime})
+}
+
+// DeleteAttachment removes the file from storage and the attachment with it
+func DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	attachment, err := findUserAttachment(r.PathValue("id"), r.PathValue("attachmentId"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Attachment not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the attachment"})
+		return
+	}
+
+	// Deleting a key that was never uploaded succeeds as well
+	if err := utils.Storage.DeleteObject(r.Context(), utils.StorageBucket, attachment.ObjectKey); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while deleting the attachment"})
+		return
+	}
+	// The row goes for good since the file it points to is gone
+	result := utils.DB.Unscoped().Delete(attachment)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while deleting the attachment"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serializeAttachment builds the JSON representation of an attachment
+// returned by the API. The download URL is left out when empty.
+func serializeAttachment(attachment models.Attachment, downloadURL string) map[string]interface{} {
+	serialized := map[string]interface{}{
+		"id":          attachment.AttachmentId,
+		"tradeId":     attachment.TradId,
+		"fileName":    attachment.FileName,
+		"contentType": attachment.ContentType,
+		"size":        attachment.Size,
+		"status":      attachment.Status,
+		"uploadedAt":  attachment.UploadedAt,
+		"createdAt":   attachment.CreatedAt,
+	}
+	if downloadURL != "" {
+		serialized["url"] = downloadURL
+	}
+	return serialized
+}
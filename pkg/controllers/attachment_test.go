@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+)
+
+const testBucket = "tradelog-test"
+
+// useTestStorage points utils.Storage at an empty MemoryStore
+func useTestStorage(t *testing.T) *utils.MemoryStore {
+	t.Helper()
+	store := utils.NewMemoryStore()
+	previousStorage, previousBucket := utils.Storage, utils.StorageBucket
+	utils.Storage, utils.StorageBucket = store, testBucket
+	t.Cleanup(func() {
+		utils.Storage, utils.StorageBucket = previousStorage, previousBucket
+	})
+	return store
+}
+
+// serveAttachment runs an attachment handler for the user and decodes the
+// JSON response
+func serveAttachment(t *testing.T, handler http.HandlerFunc, method string, userId string, tradeId string, attachmentId string, body string) (int, map[string]interface{}) {
+	t.Helper()
+	r := asUser(httptest.NewRequest(method, "/trade/"+tradeId+"/attachments", strings.NewReader(body)), userId)
+	r.SetPathValue("id", tradeId)
+	r.SetPathValue("attachmentId", attachmentId)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	var response map[string]interface{}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code, response
+}
+
+// requestUpload reserves an attachment of the trade and returns its id and
+// the object key of its upload URL
+func requestUpload(t *testing.T, userId string, tradeId string, body string) (string, string) {
+	t.Helper()
+	code, response := serveAttachment(t, AddAttachment, http.MethodPost, userId, tradeId, "", body)
+	if code != http.StatusCreated {
+		t.Fatalf("AddAttachment() status = %d, want %d: %v", code, http.StatusCreated, response)
+	}
+	attachment := response["attachment"].(map[string]interface{})
+	uploadURL := response["uploadUrl"].(string)
+	key := strings.TrimPrefix(uploadURL, "memory://"+testBucket+"/")
+	key, _, _ = strings.Cut(key, "?")
+	return attachment["id"].(string), key
+}
+
+func TestAddAttachmentKeysStayUnderUserPrefix(t *testing.T) {
+	useTestDB(t)
+	useTestStorage(t)
+	createTestTrade(t, "trade-1", "alice")
+
+	tests := []struct {
+		name     string
+		fileName string
+		fileBase string
+	}{
+		{"plain name", "chart.png", "chart.png"},
+		{"relative path", "../../users/bob/chart.png", "chart.png"},
+		{"windows path", `C:\charts\..\bob.png`, "bob.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"fileName": tt.fileName, "contentType": "image/png"})
+			attachmentId, key := requestUpload(t, "alice", "trade-1", string(body))
+			want := "users/alice/trades/trade-1/attachments/" + attachmentId + ".png"
+			if key != want {
+				t.Errorf("upload key = %q, want %q", key, want)
+			}
+			attachment, err := findUserAttachment("trade-1", attachmentId, "alice")
+			if err != nil {
+				t.Fatalf("findUserAttachment() error = %v", err)
+			}
+			if attachment.ObjectKey != want {
+				t.Errorf("ObjectKey = %q, want %q", attachment.ObjectKey, want)
+			}
+			if attachment.FileName != tt.fileBase {
+				t.Errorf("FileName = %q, want %q", attachment.FileName, tt.fileBase)
+			}
+		})
+	}
+}
+
+func TestAddAttachmentRejectsInvalidRequests(t *testing.T) {
+	useTestDB(t)
+	useTestStorage(t)
+	createTestTrade(t, "trade-1", "alice")
+
+	tests := []struct {
+		name    string
+		userId  string
+		tradeId string
+		body    string
+		status  int
+	}{
+		{"other user's trade", "bob", "trade-1", `{"fileName": "chart.png", "contentType": "image/png"}`, http.StatusNotFound},
+		{"unknown trade", "alice", "trade-2", `{"fileName": "chart.png", "contentType": "image/png"}`, http.StatusNotFound},
+		{"unsupported content type", "alice", "trade-1", `{"fileName": "chart.svg", "contentType": "image/svg+xml"}`, http.StatusBadRequest},
+		{"missing file name", "alice", "trade-1", `{"contentType": "image/png"}`, http.StatusBadRequest},
+		{"invalid payload", "alice", "trade-1", `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := serveAttachment(t, AddAttachment, http.MethodPost, tt.userId, tt.tradeId, "", tt.body)
+			if code != tt.status {
+				t.Errorf("AddAttachment() status = %d, want %d: %v", code, tt.status, response)
+			}
+		})
+	}
+	var count int64
+	utils.DB.Model(&models.Attachment{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d attachments stored, want none", count)
+	}
+}
+
+func TestConfirmAttachment(t *testing.T) {
+	tests := []struct {
+		name        string
+		userId      string
+		upload      *utils.ObjectInfo
+		status      int
+		wantStatus  string
+		wantObjects int
+	}{
+		{"not uploaded yet", "alice", nil, http.StatusConflict, models.AttachmentStatusPending, 0},
+		{"uploaded", "alice", &utils.ObjectInfo{Size: 2048, ContentType: "image/png"}, http.StatusOK, models.AttachmentStatusUploaded, 1},
+		{"other content type", "alice", &utils.ObjectInfo{Size: 2048, ContentType: "text/html"}, http.StatusBadRequest, "", 0},
+		{"too large", "alice", &utils.ObjectInfo{Size: maxAttachmentSize + 1, ContentType: "image/png"}, http.StatusBadRequest, "", 0},
+		{"other user", "bob", &utils.ObjectInfo{Size: 2048, ContentType: "image/png"}, http.StatusNotFound, models.AttachmentStatusPending, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			store := useTestStorage(t)
+			createTestTrade(t, "trade-1", "alice")
+			attachmentId, key := requestUpload(t, "alice", "trade-1", `{"fileName": "chart.png", "contentType": "image/png"}`)
+			if tt.upload != nil {
+				store.Put(testBucket, key, *tt.upload)
+			}
+
+			code, response := serveAttachment(t, ConfirmAttachment, http.MethodPost, tt.userId, "trade-1", attachmentId, "")
+			if code != tt.status {
+				t.Fatalf("ConfirmAttachment() status = %d, want %d: %v", code, tt.status, response)
+			}
+			if code == http.StatusOK && response["size"] != float64(tt.upload.Size) {
+				t.Errorf("size = %v, want %d", response["size"], tt.upload.Size)
+			}
+			attachment, err := findUserAttachment("trade-1", attachmentId, "alice")
+			switch {
+			case tt.wantStatus == "" && err == nil:
+				t.Errorf("rejected attachment was kept")
+			case tt.wantStatus != "" && err != nil:
+				t.Errorf("findUserAttachment() error = %v", err)
+			case tt.wantStatus != "" && attachment.Status != tt.wantStatus:
+				t.Errorf("Status = %q, want %q", attachment.Status, tt.wantStatus)
+			}
+			if objects := len(store.Keys(testBucket)); objects != tt.wantObjects {
+				t.Errorf("%d objects stored, want %d", objects, tt.wantObjects)
+			}
+		})
+	}
+}
+
+func TestListAndGetAttachments(t *testing.T) {
+	useTestDB(t)
+	store := useTestStorage(t)
+	createTestTrade(t, "trade-1", "alice")
+	createTestTrade(t, "trade-2", "bob")
+
+	uploadedId, uploadedKey := requestUpload(t, "alice", "trade-1", `{"fileName": "entry.png", "contentType": "image/png"}`)
+	store.Put(testBucket, uploadedKey, utils.ObjectInfo{Size: 1024, ContentType: "image/png"})
+	if code, response := serveAttachment(t, ConfirmAttachment, http.MethodPost, "alice", "trade-1", uploadedId, ""); code != http.StatusOK {
+		t.Fatalf("ConfirmAttachment() status = %d: %v", code, response)
+	}
+	pendingId, _ := requestUpload(t, "alice", "trade-1", `{"fileName": "exit.jpg", "contentType": "image/jpeg"}`)
+
+	t.Run("list", func(t *testing.T) {
+		code, response := serveAttachment(t, ListAttachments, http.MethodGet, "alice", "trade-1", "", "")
+		if code != http.StatusOK {
+			t.Fatalf("ListAttachments() status = %d: %v", code, response)
+		}
+		attachments := response["attachments"].([]interface{})
+		if len(attachments) != 1 {
+			t.Fatalf("listed %d attachments, want only the uploaded one", len(attachments))
+		}
+		attachment := attachments[0].(map[string]interface{})
+		if attachment["id"] != uploadedId {
+			t.Errorf("id = %v, want %s", attachment["id"], uploadedId)
+		}
+		wantURL := "memory://" + testBucket + "/" + uploadedKey + "?method=GET&expires=300"
+		if attachment["url"] != wantURL {
+			t.Errorf("url = %v, want %s", attachment["url"], wantURL)
+		}
+	})
+
+	tests := []struct {
+		name         string
+		userId       string
+		tradeId      string
+		attachmentId string
+		status       int
+	}{
+		{"uploaded", "alice", "trade-1", uploadedId, http.StatusOK},
+		{"pending", "alice", "trade-1", pendingId, http.StatusNotFound},
+		{"other user", "bob", "trade-1", uploadedId, http.StatusNotFound},
+		{"other user's trade path", "bob", "trade-2", uploadedId, http.StatusNotFound},
+		{"other trade", "alice", "trade-2", uploadedId, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run("get "+tt.name, func(t *testing.T) {
+			code, response := serveAttachment(t, GetAttachment, http.MethodGet, tt.userId, tt.tradeId, tt.attachmentId, "")
+			if code != tt.status {
+				t.Fatalf("GetAttachment() status = %d, want %d: %v", code, tt.status, response)
+			}
+			if code != http.StatusOK {
+				return
+			}
+			attachment := response["attachment"].(map[string]interface{})
+			url, _ := attachment["url"].(string)
+			if !strings.HasPrefix(url, "memory://"+testBucket+"/users/"+tt.userId+"/") {
+				t.Errorf("url = %q, want a key under the prefix of %s", url, tt.userId)
+			}
+		})
+	}
+
+	t.Run("list other user's trade", func(t *testing.T) {
+		code, response := serveAttachment(t, ListAttachments, http.MethodGet, "bob", "trade-1", "", "")
+		if code != http.StatusNotFound {
+			t.Errorf("ListAttachments() status = %d, want %d: %v", code, http.StatusNotFound, response)
+		}
+	})
+}
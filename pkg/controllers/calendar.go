@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/shopspring/decimal"
+)
+
+// calendarTotal is the performance of the trades closed over a calendar
+// period
+type calendarTotal struct {
+	TradeCount int64
+	WinCount   int64
+	NetPnl     decimal.Decimal
+}
+
+// add accumulates the trades of another period into the total
+func (t *calendarTotal) add(other calendarTotal) {
+	t.TradeCount += other.TradeCount
+	t.WinCount += other.WinCount
+	t.NetPnl = t.NetPnl.Add(other.NetPnl)
+}
+
+// serializeCalendarTotal builds the JSON representation of the performance
+// of a calendar period. The win rate is null for periods without trades.
+func serializeCalendarTotal(total calendarTotal) map[string]interface{} {
+	var winRate decimal.NullDecimal
+	if total.TradeCount > 0 {
+		winRate = decimal.NewNullDecimal(decimal.NewFromInt(total.WinCount).Div(decimal.NewFromInt(total.TradeCount)).Shift(2).Round(models.PercentScale))
+	}
+	return map[string]interface{}{
+		"tradeCount": total.TradeCount,
+		"winCount":   total.WinCount,
+		"winRate":    winRate,
+		"netPnl":     total.NetPnl,
+	}
+}
+
+// GetCalendarStats returns the net P&L of the caller's closed trades for
+// every day of a month, given as month=2006-01, or of a year, given as
+// year=2006, along with the totals of its weeks and months. It covers the
+// current month when neither is given. Trades count towards the day they
+// were closed on in the timezone of the profile, or the timezone parameter
+// when given. Weeks start on Monday and only total the days of the range.
+// It accepts the same filters as ListTrades.
+func GetCalendarStats(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	query := r.URL.Query()
+
+	location, message, err := userLocation(userId, query)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the profile"})
+		return
+	}
+	var start, end time.Time
+	monthParam, yearParam := query.Get("month"), query.Get("year")
+	switch {
+	case message != "":
+	case monthParam != "" && yearParam != "":
+		message = "Only one of month and year can be given"
+	case yearParam != "":
+		year, err := time.ParseInLocation("2006", yearParam, location)
+		if err != nil {
+			message = "year must be formatted as 2006"
+		}
+		start, end = year, year.AddDate(1, 0, 0)
+	case monthParam != "":
+		month, err := time.ParseInLocation("2006-01", monthParam, location)
+		if err != nil {
+			message = "month must be formatted as 2006-01"
+		}
+		start, end = month, month.AddDate(0, 1, 0)
+	default:
+		now := time.Now().In(location)
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, location)
+		end = start.AddDate(0, 1, 0)
+	}
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+
+	tx, message := filterUserTrades(userId, query)
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+	var rows []struct {
+		Day        time.Time
+		TradeCount int64
+		WinCount   int64
+		NetPnl     decimal.Decimal
+	}
+	result := tx.Where("trades.status = ? AND trades.close_position_at >= ? AND trades.close_position_at < ?", models.TradeStatusClosed, start, end).
+		Select(`(trades.close_position_at AT TIME ZONE ?)::date AS day, COUNT(*) AS trade_count,
+			COUNT(*) FILTER (WHERE trades.net_pnl > 0) AS win_count,
+			SUM(trades.net_pnl) AS net_pnl`, location.String()).
+		Group("day").Scan(&rows)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing the calendar"})
+		return
+	}
+	totals := make(map[string]calendarTotal, len(rows))
+	for _, row := range rows {
+		totals[row.Day.Format(time.DateOnly)] = calendarTotal{TradeCount: row.TradeCount, WinCount: row.WinCount, NetPnl: row.NetPnl}
+	}
+
+	// Walk every day of the range, rolling the days up into their week and
+	// month as they are passed
+	var days, weeks, months []map[string]interface{}
+	var week, month, total calendarTotal
+	weekStart, monthStart := start, start
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		dayTotal := totals[day.Format(time.DateOnly)]
+		serialized := serializeCalendarTotal(dayTotal)
+		serialized["date"] = day.Format(time.DateOnly)
+		days = append(days, serialized)
+		week.add(dayTotal)
+		month.add(dayTotal)
+		total.add(dayTotal)
+
+		next := day.AddDate(0, 0, 1)
+		if next.Weekday() == time.Monday || !next.Before(end) {
+			serialized := serializeCalendarTotal(week)
+			// Report the Monday the week starts on even when the range
+			// starts later in the week
+			serialized["weekStart"] = weekStart.AddDate(0, 0, -(int(weekStart.Weekday())+6)%7).Format(time.DateOnly)
+			serialized["from"] = weekStart.Format(time.DateOnly)
+			serialized["to"] = day.Format(time.DateOnly)
+			weeks = append(weeks, serialized)
+			week, weekStart = calendarTotal{}, next
+		}
+		if next.Day() == 1 {
+			serialized := serializeCalendarTotal(month)
+			serialized["month"] = monthStart.Format("2006-01")
+			months = append(months, serialized)
+			month, monthStart = calendarTotal{}, next
+		}
+	}
+
+	serialized := serializeCalendarTotal(total)
+	serialized["timezone"] = location.String()
+	serialized["from"] = start.Format(time.DateOnly)
+	serialized["to"] = end.AddDate(0, 0, -1).Format(time.DateOnly)
+	serialized["days"] = days
+	serialized["weeks"] = weeks
+	serialized["months"] = months
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serialized)
+}
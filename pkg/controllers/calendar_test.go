@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestCalendarTotal(t *testing.T) {
+	var total calendarTotal
+	serialized := serializeCalendarTotal(total)
+	if serialized["winRate"].(decimal.NullDecimal).Valid {
+		t.Errorf("serializeCalendarTotal() of a day without trades = %v, want a null win rate", serialized)
+	}
+
+	total.add(calendarTotal{TradeCount: 2, WinCount: 1, NetPnl: decimal.NewFromInt(50)})
+	total.add(calendarTotal{TradeCount: 1, WinCount: 1, NetPnl: decimal.NewFromInt(-20)})
+	if total.TradeCount != 3 || total.WinCount != 2 || !total.NetPnl.Equal(decimal.NewFromInt(30)) {
+		t.Errorf("total = %+v, want 3 trades, 2 wins and 30", total)
+	}
+	winRate := serializeCalendarTotal(total)["winRate"].(decimal.NullDecimal)
+	if !winRate.Valid || !winRate.Decimal.Equal(decimal.RequireFromString("66.66666667")) {
+		t.Errorf("winRate = %v, want 66.66666667", winRate)
+	}
+}
+
+func TestGetCalendarStatsRejectsInvalidRanges(t *testing.T) {
+	useTestDB(t)
+	createTestUser(t, "alice")
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"month and year", "month=2024-03&year=2024"},
+		{"malformed month", "month=03-2024"},
+		{"malformed year", "year=24"},
+		{"invalid timezone", "month=2024-03&timezone=Local"},
+		{"invalid filter", "month=2024-03&status=pending"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := asUser(httptest.NewRequest(http.MethodGet, "/stats/calendar?"+tt.query, nil), "alice")
+			w := httptest.NewRecorder()
+			GetCalendarStats(w, r)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("GetCalendarStats(%s) status = %d, want %d: %s", tt.query, w.Code, http.StatusBadRequest, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/glebarez/sqlite"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDB points utils.DB at an in-memory SQLite database with the schema
+// migrated, private to the test
+func useTestDB(t *testing.T, tables ...interface{}) {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared&_pragma=foreign_keys(1)", strings.ReplaceAll(t.Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("opening the test database: %v", err)
+	}
+	if err := db.AutoMigrate(append([]interface{}{&models.User{}, &models.Account{}, &models.Trade{}, &models.Execution{}, &models.LedgerEntry{}, &models.Tag{}, &models.Note{}, &models.NoteRevision{}, &models.Attachment{}, &models.Instrument{}, &models.InstrumentAlias{}, &models.OptionStrategy{}, &models.FundingPayment{}}, tables...)...); err != nil {
+		t.Fatalf("migrating the test database: %v", err)
+	}
+	previous := utils.DB
+	utils.DB = db
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+		utils.DB = previous
+	})
+}
+
+// asUser authenticates the request as the user, as AuthenticationMiddleware
+// does
+func asUser(r *http.Request, userId string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), "username", userId))
+}
+
+// createTestUser stores the user unless it already exists
+func createTestUser(t *testing.T, userId string) {
+	t.Helper()
+	user := &models.User{UserId: userId, Email: userId + "@example.com"}
+	if err := utils.DB.Where(models.User{UserId: userId}).FirstOrCreate(user).Error; err != nil {
+		t.Fatalf("creating user %s: %v", userId, err)
+	}
+}
+
+// createTestTrade stores an open trade of the user, creating the user first when
+// needed
+func createTestTrade(t *testing.T, tradeId string, userId string) {
+	t.Helper()
+	createTestUser(t, userId)
+	trade := &models.Trade{
+		TradId:         tradeId,
+		UserId:         userId,
+		Asset:          "AAPL",
+		Status:         models.TradeStatusOpen,
+		Direction:      models.TradeDirectionLong,
+		Quantity:       decimal.NewFromInt(10),
+		OpenPositionAt: time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC),
+		Margin:         decimal.NewFromInt(1000),
+		OpenPrice:      decimal.NewFromInt(100),
+	}
+	if err := utils.DB.Create(trade).Error; err != nil {
+		t.Fatalf("creating trade %s: %v", tradeId, err)
+	}
+}
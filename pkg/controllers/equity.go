@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/shopspring/decimal"
+)
+
+// equityIntervals are the granularities of the equity curve, mapped to the
+// date_trunc field closed trades are grouped by. Trade granularity has a
+// point per closed trade.
+var equityIntervals = map[string]string{
+	"trade": "",
+	"day":   "day",
+	"week":  "week",
+	"month": "month",
+}
+
+// equityPoint is a point of the equity curve
+type equityPoint struct {
+	At          time.Time
+	TradeId     string
+	TradeCount  int64
+	Pnl         decimal.Decimal
+	Equity      decimal.Decimal
+	Peak        decimal.Decimal
+	Drawdown    decimal.Decimal
+	DrawdownPct decimal.Decimal
+}
+
+// drawdownPeriod runs from a peak of the equity curve until the curve is
+// back at that peak. PeakAt is nil when the peak is the starting equity of
+// a curve without a start time, and RecoveredAt is nil while the period has
+// not recovered yet.
+type drawdownPeriod struct {
+	PeakAt      *time.Time
+	TroughAt    time.Time
+	RecoveredAt *time.Time
+	Amount      decimal.Decimal
+	Percent     decimal.Decimal
+}
+
+// endAt is when the period recovered, or the end of the curve when it has
+// not recovered yet
+func (p *drawdownPeriod) endAt(curveEnd time.Time) time.Time {
+	if p.RecoveredAt != nil {
+		return *p.RecoveredAt
+	}
+	return curveEnd
+}
+
+// duration is how long the period lasted. Periods from a peak without a
+// time are measured from the first point of the curve, which is as early as
+// they can have started.
+func (p *drawdownPeriod) duration(curveStart time.Time, curveEnd time.Time) time.Duration {
+	if p.PeakAt != nil {
+		curveStart = *p.PeakAt
+	}
+	return p.endAt(curveEnd).Sub(curveStart)
+}
+
+// drawdownPercent is the drawdown relative to the peak, in percent. It is
+// zero while the peak is not positive.
+func drawdownPercent(drawdown decimal.Decimal, peak decimal.Decimal) decimal.Decimal {
+	if !peak.IsPositive() {
+		return decimal.Zero
+	}
+	return drawdown.Div(peak).Shift(2).Round(models.PercentScale)
+}
+
+// buildEquityCurve accumulates the P&L of the points onto the starting
+// equity and tracks the running peak, returning the drawdown periods of the
+// curve in order. startAt is when the curve starts at the starting equity,
+// nil when it is not known.
+func buildEquityCurve(points []equityPoint, startingEquity decimal.Decimal, startAt *time.Time) []drawdownPeriod {
+	var periods []drawdownPeriod
+	var current *drawdownPeriod
+	equity, peak := startingEquity, startingEquity
+	peakAt := startAt
+	for i := range points {
+		point := &points[i]
+		equity = equity.Add(point.Pnl)
+		if equity.GreaterThanOrEqual(peak) {
+			if current != nil {
+				recoveredAt := point.At
+				current.RecoveredAt = &recoveredAt
+				periods = append(periods, *current)
+				current = nil
+			}
+			pointAt := point.At
+			peak, peakAt = equity, &pointAt
+		} else {
+			drawdown := peak.Sub(equity)
+			if current == nil {
+				current = &drawdownPeriod{PeakAt: peakAt}
+			}
+			if drawdown.GreaterThan(current.Amount) {
+				current.Amount = drawdown
+				current.Percent = drawdownPercent(drawdown, peak)
+				current.TroughAt = point.At
+			}
+		}
+		point.Equity = equity
+		point.Peak = peak
+		point.Drawdown = peak.Sub(equity)
+		point.DrawdownPct = drawdownPercent(point.Drawdown, peak)
+	}
+	if current != nil {
+		periods = append(periods, *current)
+	}
+	return periods
+}
+
+// durationDays expresses a duration in days
+func durationDays(duration time.Duration) decimal.Decimal {
+	return decimal.NewFromFloat(duration.Hours() / 24).Round(4)
+}
+
+// serializeDrawdownPeriod builds the JSON representation of a drawdown
+// period. Periods that have not recovered last until the end of the curve,
+// and the duration of periods from a peak without a time is unknown.
+func serializeDrawdownPeriod(period *drawdownPeriod, end time.Time) map[string]interface{} {
+	if period == nil {
+		return nil
+	}
+	var duration, recoveryDays *decimal.Decimal
+	if period.PeakAt != nil {
+		days := durationDays(period.endAt(end).Sub(*period.PeakAt))
+		duration = &days
+	}
+	if period.RecoveredAt != nil {
+		days := durationDays(period.RecoveredAt.Sub(period.TroughAt))
+		recoveryDays = &days
+	}
+	return map[string]interface{}{
+		"amount":       period.Amount,
+		"percent":      period.Percent,
+		"peakAt":       period.PeakAt,
+		"troughAt":     period.TroughAt,
+		"recoveredAt":  period.RecoveredAt,
+		"durationDays": duration,
+		"recoveryDays": recoveryDays,
+	}
+}
+
+// GetEquityCurve returns the cumulative net P&L of the caller's closed
+// trades as an equity curve with its running peak and drawdown. The
+// interval is trade, day, week or month, days being UTC calendar days, and
+// startingEquity is where the curve starts from, 0 by default. Along with
+// the curve come the maximum drawdown, the longest drawdown and the current
+// one. The curve starts at closeFrom when it is given. It accepts the same
+// filters as ListTrades.
+func GetEquityCurve(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	query := r.URL.Query()
+
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = "trade"
+	}
+	field, ok := equityIntervals[interval]
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "interval must be trade, day, week or month"})
+		return
+	}
+	startingEquity := decimal.Zero
+	if startParam := query.Get("startingEquity"); startParam != "" {
+		parsed, err := decimal.NewFromString(startParam)
+		if err != nil || parsed.IsNegative() {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "startingEquity must be a number of at least 0"})
+			return
+		}
+		startingEquity = parsed
+	}
+
+	tx, message := filterUserTrades(userId, query)
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+	tx = tx.Where("trades.status = ? AND trades.close_position_at IS NOT NULL", models.TradeStatusClosed)
+
+	var rows []struct {
+		At         time.Time
+		TradId     string
+		TradeCount int64
+		Pnl        decimal.Decimal
+	}
+	var err error
+	if field == "" {
+		err = tx.Select("trades.close_position_at AS at, trades.trad_id, 1 AS trade_count, trades.net_pnl AS pnl").
+			Order("trades.close_position_at, trades.id").Scan(&rows).Error
+	} else {
+		err = tx.Select("date_trunc(?, trades.close_position_at AT TIME ZONE 'UTC') AS at, COUNT(*) AS trade_count, SUM(trades.net_pnl) AS pnl", field).
+			Group("at").Order("at").Scan(&rows).Error
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing the equity curve"})
+		return
+	}
+
+	points := make([]equityPoint, 0, len(rows))
+	for _, row := range rows {
+		points = append(points, equityPoint{At: row.At, TradeId: row.TradId, TradeCount: row.TradeCount, Pnl: row.Pnl})
+	}
+	// filterUserTrades has already checked closeFrom
+	var startAt *time.Time
+	if closeFrom, err := time.Parse(time.RFC3339, query.Get("closeFrom")); err == nil {
+		startAt = &closeFrom
+	}
+	periods := buildEquityCurve(points, startingEquity, startAt)
+
+	var start, end time.Time
+	if len(points) > 0 {
+		start = points[0].At
+	}
+	maxDrawdownPct := decimal.Zero
+	series := make([]map[string]interface{}, 0, len(points))
+	for _, point := range points {
+		end = point.At
+		maxDrawdownPct = decimal.Max(maxDrawdownPct, point.DrawdownPct)
+		serialized := map[string]interface{}{
+			"at":          point.At,
+			"tradeCount":  point.TradeCount,
+			"pnl":         point.Pnl,
+			"equity":      point.Equity,
+			"peak":        point.Peak,
+			"drawdown":    point.Drawdown,
+			"drawdownPct": point.DrawdownPct,
+		}
+		if field == "" {
+			serialized["tradeId"] = point.TradeId
+		}
+		series = append(series, serialized)
+	}
+
+	var maxDrawdown, longestDrawdown, currentDrawdown *drawdownPeriod
+	for i := range periods {
+		period := &periods[i]
+		if maxDrawdown == nil || period.Amount.GreaterThan(maxDrawdown.Amount) {
+			maxDrawdown = period
+		}
+		if longestDrawdown == nil || period.duration(start, end) > longestDrawdown.duration(start, end) {
+			longestDrawdown = period
+		}
+		if period.RecoveredAt == nil {
+			currentDrawdown = period
+		}
+	}
+
+	finalEquity := startingEquity
+	if len(points) > 0 {
+		finalEquity = points[len(points)-1].Equity
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"interval":           interval,
+		"startingEquity":     startingEquity,
+		"endingEquity":       finalEquity,
+		"maxDrawdown":        serializeDrawdownPeriod(maxDrawdown, end),
+		"maxDrawdownPercent": maxDrawdownPct,
+		"longestDrawdown":    serializeDrawdownPeriod(longestDrawdown, end),
+		"currentDrawdown":    serializeDrawdownPeriod(currentDrawdown, end),
+		"series":             series,
+	})
+}
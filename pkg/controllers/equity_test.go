@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+func TestBuildEquityCurve(t *testing.T) {
+	day := func(n int) time.Time {
+		return time.Date(2024, 3, n, 0, 0, 0, 0, time.UTC)
+	}
+	type point struct {
+		equity, peak, drawdown, drawdownPct string
+	}
+	type period struct {
+		peakAt          int // -1 when the peak has no time
+		troughAt        int
+		recoveredAt     int // 0 while not recovered
+		amount, percent string
+	}
+	tests := []struct {
+		name     string
+		starting string
+		// started tells whether the curve starts on day 0, before the first
+		// point
+		started bool
+		pnls    []string
+		points  []point
+		periods []period
+	}{
+		{"no points", "1000", false, nil, nil, nil},
+		{
+			"only gains",
+			"1000",
+			false,
+			[]string{"100", "50"},
+			[]point{{"1100", "1100", "0", "0"}, {"1150", "1150", "0", "0"}},
+			nil,
+		},
+		{
+			"recovered then open drawdown",
+			"1000",
+			false,
+			[]string{"100", "-200", "50", "300", "-100"},
+			[]point{
+				{"1100", "1100", "0", "0"},
+				{"900", "1100", "200", "18.18181818"},
+				{"950", "1100", "150", "13.63636364"},
+				{"1250", "1250", "0", "0"},
+				{"1150", "1250", "100", "8"},
+			},
+			[]period{
+				{peakAt: 1, troughAt: 2, recoveredAt: 4, amount: "200", percent: "18.18181818"},
+				{peakAt: 4, troughAt: 5, amount: "100", percent: "8"},
+			},
+		},
+		{
+			"back exactly at the peak",
+			"1000",
+			false,
+			[]string{"-100", "100"},
+			[]point{{"900", "1000", "100", "10"}, {"1000", "1000", "0", "0"}},
+			[]period{{peakAt: -1, troughAt: 1, recoveredAt: 2, amount: "100", percent: "10"}},
+		},
+		{
+			"drawdown from the start of the range",
+			"1000",
+			true,
+			[]string{"-100", "100"},
+			[]point{{"900", "1000", "100", "10"}, {"1000", "1000", "0", "0"}},
+			[]period{{peakAt: 0, troughAt: 1, recoveredAt: 2, amount: "100", percent: "10"}},
+		},
+		{
+			"no starting equity",
+			"0",
+			false,
+			[]string{"-50", "-30", "100"},
+			[]point{{"-50", "0", "50", "0"}, {"-80", "0", "80", "0"}, {"20", "20", "0", "0"}},
+			[]period{{peakAt: -1, troughAt: 2, recoveredAt: 3, amount: "80", percent: "0"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points := make([]equityPoint, len(tt.pnls))
+			for i, pnl := range tt.pnls {
+				points[i] = equityPoint{At: day(i + 1), Pnl: decimal.RequireFromString(pnl)}
+			}
+			var startAt *time.Time
+			if tt.started {
+				start := day(0)
+				startAt = &start
+			}
+			periods := buildEquityCurve(points, decimal.RequireFromString(tt.starting), startAt)
+
+			for i, want := range tt.points {
+				got := points[i]
+				if !got.Equity.Equal(decimal.RequireFromString(want.equity)) || !got.Peak.Equal(decimal.RequireFromString(want.peak)) ||
+					!got.Drawdown.Equal(decimal.RequireFromString(want.drawdown)) || !got.DrawdownPct.Equal(decimal.RequireFromString(want.drawdownPct)) {
+					t.Errorf("point %d = equity %s peak %s drawdown %s (%s%%), want %s %s %s (%s%%)", i,
+						got.Equity, got.Peak, got.Drawdown, got.DrawdownPct, want.equity, want.peak, want.drawdown, want.drawdownPct)
+				}
+			}
+			if len(periods) != len(tt.periods) {
+				t.Fatalf("got %d drawdown periods, want %d: %+v", len(periods), len(tt.periods), periods)
+			}
+			for i, want := range tt.periods {
+				got := periods[i]
+				switch {
+				case want.peakAt == -1 && got.PeakAt != nil:
+					t.Errorf("period %d peaked at %v, want no peak time", i, got.PeakAt)
+				case want.peakAt != -1 && (got.PeakAt == nil || !got.PeakAt.Equal(day(want.peakAt))):
+					t.Errorf("period %d peaked at %v, want day %d", i, got.PeakAt, want.peakAt)
+				}
+				if !got.TroughAt.Equal(day(want.troughAt)) {
+					t.Errorf("period %d bottomed at %v, want day %d", i, got.TroughAt, want.troughAt)
+				}
+				switch {
+				case want.recoveredAt == 0 && got.RecoveredAt != nil:
+					t.Errorf("period %d recovered at %v, want it still open", i, got.RecoveredAt)
+				case want.recoveredAt != 0 && (got.RecoveredAt == nil || !got.RecoveredAt.Equal(day(want.recoveredAt))):
+					t.Errorf("period %d recovered at %v, want day %d", i, got.RecoveredAt, want.recoveredAt)
+				}
+				if !got.Amount.Equal(decimal.RequireFromString(want.amount)) || !got.Percent.Equal(decimal.RequireFromString(want.percent)) {
+					t.Errorf("period %d = %s (%s%%), want %s (%s%%)", i, got.Amount, got.Percent, want.amount, want.percent)
+				}
+			}
+		})
+	}
+}
+
+func TestGetEquityCurve(t *testing.T) {
+	useTestDB(t)
+	for i, pnl := range []int64{-100, 150, -20} {
+		tradeId := fmt.Sprintf("trade-%d", i+1)
+		createTestTrade(t, tradeId, "alice")
+		closedAt := time.Date(2024, 3, 5+i, 15, 0, 0, 0, time.UTC)
+		updates := map[string]interface{}{"status": models.TradeStatusClosed, "close_position_at": closedAt, "net_pnl": pnl}
+		if err := utils.DB.Model(&models.Trade{}).Where("trad_id = ?", tradeId).Updates(updates).Error; err != nil {
+			t.Fatalf("closing %s: %v", tradeId, err)
+		}
+	}
+
+	equityCurve := func(query string) map[string]interface{} {
+		t.Helper()
+		r := asUser(httptest.NewRequest(http.MethodGet, "/stats/equity?"+query, nil), "alice")
+		w := httptest.NewRecorder()
+		GetEquityCurve(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GetEquityCurve(%s) status = %d: %s", query, w.Code, w.Body.String())
+		}
+		var response map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+		}
+		return response
+	}
+
+	// The drawdown of the first trade starts at the starting equity, whose
+	// time is only known when the range has a start
+	response := equityCurve("startingEquity=1000")
+	maxDrawdown := response["maxDrawdown"].(map[string]interface{})
+	if maxDrawdown["amount"] != "100" || maxDrawdown["peakAt"] != nil || maxDrawdown["durationDays"] != nil {
+		t.Errorf("maxDrawdown = %v, want 100 from a peak without a time", maxDrawdown)
+	}
+	if response["endingEquity"] != "1030" || len(response["series"].([]interface{})) != 3 {
+		t.Errorf("GetEquityCurve() = %v, want 3 points ending at 1030", response)
+	}
+
+	response = equityCurve("startingEquity=1000&closeFrom=2024-03-01T00:00:00Z")
+	maxDrawdown = response["maxDrawdown"].(map[string]interface{})
+	if maxDrawdown["peakAt"] != "2024-03-01T00:00:00Z" || maxDrawdown["durationDays"] != "5.625" {
+		t.Errorf("maxDrawdown = %v, want it to run from the start of the range for 5.625 days", maxDrawdown)
+	}
+	current := response["currentDrawdown"].(map[string]interface{})
+	if current["amount"] != "20" || current["peakAt"] != "2024-03-06T15:00:00Z" {
+		t.Errorf("currentDrawdown = %v, want 20 from the second trade", current)
+	}
+
+	for _, query := range []string{"interval=year", "startingEquity=-1", "closeFrom=yesterday"} {
+		r := asUser(httptest.NewRequest(http.MethodGet, "/stats/equity?"+query, nil), "alice")
+		w := httptest.NewRecorder()
+		GetEquityCurve(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GetEquityCurve(%s) status = %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExecutionsHandler dispatches /trade/{id}/executions to the handler for the request method
+func ExecutionsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ListExecutions(w, r)
+	case http.MethodPost:
+		AddExecution(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// orderExecutions preloads a trade's executions in the order they were filled
+func orderExecutions(db *gorm.DB) *gorm.DB {
+	return db.Order("executed_at, id")
+}
+
+func ListExecutions(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+
+	executions := make([]map[string]interface{}, 0, len(trade.Executions))
+	for _, execution := range trade.Executions {
+		executions = append(executions, serializeExecution(execution))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"executions": executions})
+}
+
+// AddExecution records a fill on the trade and re-derives the trade's size,
+// average prices and P&L from its executions
+func AddExecution(w http.ResponseWriter, r *http.Request) {
+	type FormData struct {
+		Side       string          `json:"side"`
+		Quantity   decimal.Decimal `json:"quantity"`
+		Price      decimal.Decimal `json:"price"`
+		ExecutedAt time.Time       `json:"executedAt"`
+		Fee        decimal.Decimal `json:"fee"`
+	}
+
+	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+
+	var data FormData
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+
+	// Validate required fields
+	if data.Side != models.ExecutionSideBuy && data.Side != models.ExecutionSideSell {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Side must be buy or sell"})
+		return
+	}
+	if data.Quantity.Sign() <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Quantity must be greater than 0"})
+		return
+	}
+	if data.Price.Sign() <= 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Price must be greater than 0"})
+		return
+	}
+	if data.Fee.Sign() < 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Fee must not be negative"})
+		return
+	}
+	if data.ExecutedAt.IsZero() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "ExecutedAt is required"})
+		return
+	}
+
+	execution, err := addTradeExecution(trade, models.Execution{
+		Side:       data.Side,
+		Quantity:   data.Quantity,
+		Price:      data.Price,
+		ExecutedAt: data.ExecutedAt,
+		Fee:        data.Fee,
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, models.ErrExecutionOverfill) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while adding the execution"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"execution": serializeExecution(*execution),
+		"trade":     serializeTrade(*trade),
+	})
+}
+
+// DeleteExecution soft deletes a fill and re-derives the trade from the rest
+func DeleteExecution(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+
+	var removed *models.Execution
+	executions := make([]models.Execution, 0, len(trade.Executions))
+	for i, execution := range trade.Executions {
+		if execution.ExecutionId == r.PathValue("executionId") {
+			removed = &trade.Executions[i]
+			continue
+		}
+		executions = append(executions, execution)
+	}
+	if removed == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Execution not found"})
+		return
+	}
+
+	trade.Executions = executions
+	if err := trade.ApplyExecutions(); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(removed).Error; err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Save(trade).Error
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while deleting the execution"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addTradeExecution stores the execution and re-derives the trade from its
+// executions. A trade journaled without executions first gets its own entry
+// and exit recorded as executions, so fills added later build on them.
+func addTradeExecution(trade *models.Trade, execution models.Execution) (*models.Execution, error) {
+	created, err := prepareTradeExecution(trade, execution)
+	if err != nil {
+		return nil, err
+	}
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&created).Error; err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Save(trade).Error
+	})
+	return &created[len(created)-1], err
+}
+
+// prepareTradeExecution adds the execution to the trade in memory and
+// returns the executions that need to be created for it, which include the
+// seeded ones on the first execution of a trade
+func prepareTradeExecution(trade *models.Trade, execution models.Execution) ([]models.Execution, error) {
+	var created []models.Execution
+	if len(trade.Executions) == 0 {
+		created = append(created, seedExecutions(trade)...)
+	}
+	execution.ExecutionId = uuid.New().String()
+	execution.TradId = trade.TradId
+	created = append(created, execution)
+
+	trade.Executions = append(trade.Executions, created...)
+	if err := trade.ApplyExecutions(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// seedExecutions converts the entry and exit stored on the trade into executions
+func seedExecutions(trade *models.Trade) []models.Execution {
+	if trade.Quantity.IsZero() {
+		return nil
+	}
+	executions := []models.Execution{{
+		ExecutionId: uuid.New().String(),
+		TradId:      trade.TradId,
+		Side:        trade.EntrySide(),
+		Quantity:    trade.Quantity,
+		Price:       trade.OpenPrice,
+		ExecutedAt:  trade.OpenPositionAt,
+	}}
+	if !trade.ExitedQuantity.IsZero() {
+		exitedAt := trade.OpenPositionAt
+		if trade.ClosePositionAt != nil {
+			exitedAt = *trade.ClosePositionAt
+		}
+		executions = append(executions, models.Execution{
+			ExecutionId: uuid.New().String(),
+			TradId:      trade.TradId,
+			Side:        oppositeSide(trade.EntrySide()),
+			Quantity:    trade.ExitedQuantity,
+			Price:       trade.ClosePrice,
+			ExecutedAt:  exitedAt,
+		})
+	}
+	return executions
+}
+
+// closeTradeWithExecution closes a trade journaled with executions by
+// recording the exit as another execution
+func closeTradeWithExecution(w http.ResponseWriter, trade *models.Trade, execution models.Execution) {
+	_, err := addTradeExecution(trade, execution)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, models.ErrExecutionOverfill) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while closing the trade"})
+		return
+	}
+
+	resp := map[string]interface{}{
+		"closed":    nil,
+		"remaining": nil,
+	}
+	if trade.IsOpen() {
+		resp["remaining"] = serializeTrade(*trade)
+	} else {
+		resp["closed"] = serializeTrade(*trade)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func oppositeSide(side string) string {
+	if side == models.ExecutionSideBuy {
+		return models.ExecutionSideSell
+	}
+	return models.ExecutionSideBuy
+}
+
+// serializeExecution builds the JSON representation of an execution returned by the API
+func serializeExecution(execution models.Execution) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         execution.ExecutionId,
+		"side":       execution.Side,
+		"quantity":   execution.Quantity,
+		"price":      execution.Price,
+		"executedAt": execution.ExecutedAt,
+		"fee":        execution.Fee,
+	}
+}
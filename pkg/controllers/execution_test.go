@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+)
+
+// serveExecution runs an execution handler on the trade for the user and
+// decodes the JSON response
+func serveExecution(t *testing.T, handler http.HandlerFunc, method string, userId string, tradeId string, executionId string, body string) (int, map[string]interface{}) {
+	t.Helper()
+	r := asUser(httptest.NewRequest(method, "/trade/"+tradeId+"/executions", strings.NewReader(body)), userId)
+	r.SetPathValue("id", tradeId)
+	r.SetPathValue("executionId", executionId)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	var response map[string]interface{}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code, response
+}
+
+func TestAddExecutionRejectsInvalidFills(t *testing.T) {
+	useTestDB(t)
+	createTestTrade(t, "trade-1", "alice")
+
+	tests := []struct {
+		name   string
+		userId string
+		body   string
+		status int
+	}{
+		{"other user's trade", "bob", `{"side": "sell", "quantity": "4", "price": "110", "executedAt": "2024-03-05T15:00:00Z"}`, http.StatusNotFound},
+		{"unknown side", "alice", `{"side": "hold", "quantity": "4", "price": "110", "executedAt": "2024-03-05T15:00:00Z"}`, http.StatusBadRequest},
+		{"no quantity", "alice", `{"side": "sell", "price": "110", "executedAt": "2024-03-05T15:00:00Z"}`, http.StatusBadRequest},
+		{"no price", "alice", `{"side": "sell", "quantity": "4", "executedAt": "2024-03-05T15:00:00Z"}`, http.StatusBadRequest},
+		{"negative fee", "alice", `{"side": "sell", "quantity": "4", "price": "110", "fee": "-1", "executedAt": "2024-03-05T15:00:00Z"}`, http.StatusBadRequest},
+		{"no execution time", "alice", `{"side": "sell", "quantity": "4", "price": "110"}`, http.StatusBadRequest},
+		{"more than the position", "alice", `{"side": "sell", "quantity": "12", "price": "110", "executedAt": "2024-03-05T15:00:00Z"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := serveExecution(t, AddExecution, http.MethodPost, tt.userId, "trade-1", "", tt.body)
+			if code != tt.status {
+				t.Errorf("AddExecution() status = %d, want %d: %v", code, tt.status, response)
+			}
+		})
+	}
+	var count int64
+	utils.DB.Model(&models.Execution{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d executions stored, want none", count)
+	}
+}
+
+func TestExecutionsDeriveTheTrade(t *testing.T) {
+	useTestDB(t)
+	createTestTrade(t, "trade-1", "alice")
+
+	// The first fill seeds the entry journaled on the trade
+	code, response := serveExecution(t, AddExecution, http.MethodPost, "alice", "trade-1", "", `{"side": "sell", "quantity": "4", "price": "110", "executedAt": "2024-03-05T15:00:00Z"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("AddExecution() status = %d: %v", code, response)
+	}
+	trade := response["trade"].(map[string]interface{})
+	if trade["status"] != models.TradeStatusOpen || trade["exitedQuantity"] != "4" || trade["realizedPnl"] != "40" {
+		t.Errorf("trade = %v, want 4 of 10 closed for 40", trade)
+	}
+
+	code, response = serveExecution(t, AddExecution, http.MethodPost, "alice", "trade-1", "", `{"side": "sell", "quantity": "6", "price": "120", "executedAt": "2024-03-06T15:00:00Z"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("AddExecution() status = %d: %v", code, response)
+	}
+	lastId := response["execution"].(map[string]interface{})["id"].(string)
+	trade = response["trade"].(map[string]interface{})
+	if trade["status"] != models.TradeStatusClosed || trade["closePrice"] != "116" || trade["realizedPnl"] != "160" {
+		t.Errorf("trade = %v, want it closed at 116 for 160", trade)
+	}
+
+	code, response = serveExecution(t, ListExecutions, http.MethodGet, "alice", "trade-1", "", "")
+	if code != http.StatusOK {
+		t.Fatalf("ListExecutions() status = %d: %v", code, response)
+	}
+	if executions := response["executions"].([]interface{}); len(executions) != 3 {
+		t.Errorf("listed %d executions, want the seeded entry and both exits", len(executions))
+	}
+
+	if code, response := serveExecution(t, DeleteExecution, http.MethodDelete, "bob", "trade-1", lastId, ""); code != http.StatusNotFound {
+		t.Errorf("DeleteExecution() by another user status = %d, want %d: %v", code, http.StatusNotFound, response)
+	}
+	if code, response := serveExecution(t, DeleteExecution, http.MethodDelete, "alice", "trade-1", lastId, ""); code != http.StatusNoContent {
+		t.Fatalf("DeleteExecution() status = %d: %v", code, response)
+	}
+	stored, err := findUserTrade("trade-1", "alice")
+	if err != nil {
+		t.Fatalf("findUserTrade() error = %v", err)
+	}
+	if !stored.IsOpen() || len(stored.Executions) != 2 || stored.ExitedQuantity.String() != "4" {
+		t.Errorf("trade after the delete = %s with %d executions, %s exited, want it open again", stored.Status, len(stored.Executions), stored.ExitedQuantity)
+	}
+}
+
+func TestAddExecutionKeepsManualCommission(t *testing.T) {
+	useTestDB(t)
+	createTestTrade(t, "trade-1", "alice")
+	if err := utils.DB.Model(&models.Trade{}).Where("trad_id = ?", "trade-1").Update("commission", 5).Error; err != nil {
+		t.Fatalf("setting the commission: %v", err)
+	}
+
+	code, response := serveExecution(t, AddExecution, http.MethodPost, "alice", "trade-1", "", `{"side": "sell", "quantity": "10", "price": "110", "fee": "2", "executedAt": "2024-03-05T15:00:00Z"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("AddExecution() status = %d: %v", code, response)
+	}
+	trade := response["trade"].(map[string]interface{})
+	if trade["commission"] != "5" || trade["executionFees"] != "2" || trade["totalCosts"] != "7" || trade["netPnl"] != "93" {
+		t.Errorf("trade = %v, want the commission of 5 kept next to execution fees of 2", trade)
+	}
+}
@@ -0,0 +1,303 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RollHandler dispatches /trade/{id}/roll to the handler for the request method
+func RollHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		LinkRoll(w, r)
+	case http.MethodDelete:
+		UnlinkRoll(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// LinkRoll records that the futures trade was rolled from a position in an
+// earlier contract month of the same root. The earlier position must be
+// closed and on the same side.
+func LinkRoll(w http.ResponseWriter, r *http.Request) {
+	type FormData struct {
+		RolledFromId string `json:"rolledFromId"`
+	}
+
+	var data FormData
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+
+	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+	previous, err := findUserTrade(data.RolledFromId, userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Rolled from trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+
+	var message string
+	switch {
+	case !trade.IsFuture() || !previous.IsFuture():
+		message = "Only futures trades can be rolled"
+	case trade.RootSymbol != previous.RootSymbol:
+		message = "A roll must stay on the same root symbol"
+	case trade.Direction != previous.Direction:
+		message = "A roll must stay on the same side"
+	case previous.IsOpen():
+		message = "The rolled from trade must be closed"
+	case trade.ContractMonth == "" || previous.ContractMonth == "" || trade.ContractMonth <= previous.ContractMonth:
+		message = "A roll must go to a later contract month"
+	}
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+
+	trade.RolledFromTradId = previous.TradId
+	result := utils.DB.Omit(clause.Associations).Save(trade)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while linking the roll"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serializeTrade(*trade))
+}
+
+// UnlinkRoll removes the roll link of the trade
+func UnlinkRoll(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+
+	trade.RolledFromTradId = ""
+	result := utils.DB.Omit(clause.Associations).Save(trade)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while unlinking the roll"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// futuresPosition is a position in a futures root held across contract
+// months: the trades linked by rolls, along with the parts split off them
+// by partial closes
+type futuresPosition struct {
+	trades []models.Trade
+}
+
+// groupFuturesPositions puts trades connected through RolledFromTradId or
+// ParentTradId into the same position. Trades whose link points outside of
+// the given trades start a position of their own.
+func groupFuturesPositions(trades []models.Trade) []*futuresPosition {
+	parent := map[string]string{}
+	var find func(string) string
+	find = func(id string) string {
+		if parent[id] == id {
+			return id
+		}
+		parent[id] = find(parent[id])
+		return parent[id]
+	}
+	for _, trade := range trades {
+		parent[trade.TradId] = trade.TradId
+	}
+	for _, trade := range trades {
+		for _, linked := range []string{trade.RolledFromTradId, trade.ParentTradId} {
+			if _, ok := parent[linked]; ok {
+				parent[find(trade.TradId)] = find(linked)
+			}
+		}
+	}
+
+	positions := map[string]*futuresPosition{}
+	var ordered []*futuresPosition
+	for _, trade := range trades {
+		root := find(trade.TradId)
+		if positions[root] == nil {
+			positions[root] = &futuresPosition{}
+			ordered = append(ordered, positions[root])
+		}
+		positions[root].trades = append(positions[root].trades, trade)
+	}
+	return ordered
+}
+
+// GetFuturesStats reports continuous performance per futures root symbol.
+// Positions rolled from one contract month to the next count as a single
+// position of the root. It accepts the same filters as ListTrades.
+func GetFuturesStats(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+
+	tx, message := filterUserTrades(userId, r.URL.Query())
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+	var trades []models.Trade
+	result := tx.Where("trades.root_symbol <> ''").Order("trades.open_position_at, trades.id").Find(&trades)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing futures statistics"})
+		return
+	}
+
+	type rootStats struct {
+		positions                       []map[string]interface{}
+		tradeCount, rolls, wins, closed int
+		contracts                       decimal.Decimal
+		realizedPnl, totalCosts, netPnl decimal.Decimal
+	}
+	stats := map[string]*rootStats{}
+	var roots []string
+	for _, position := range groupFuturesPositions(trades) {
+		root := position.trades[0].RootSymbol
+		if stats[root] == nil {
+			stats[root] = &rootStats{}
+			roots = append(roots, root)
+		}
+		rs := stats[root]
+
+		var realizedPnl, totalCosts, netPnl decimal.Decimal
+		var contractMonths []string
+		var tradeIds []string
+		var closedAt *time.Time
+		open, rolls := false, 0
+		for _, trade := range position.trades {
+			tradeIds = append(tradeIds, trade.TradId)
+			if !slices.Contains(contractMonths, trade.ContractMonth) {
+				contractMonths = append(contractMonths, trade.ContractMonth)
+			}
+			if trade.RolledFromTradId != "" {
+				rolls++
+			}
+			realizedPnl = realizedPnl.Add(trade.RealizedPnl)
+			totalCosts = totalCosts.Add(trade.TotalCosts())
+			netPnl = netPnl.Add(trade.NetPnl)
+			rs.contracts = rs.contracts.Add(trade.ExitedQuantity)
+			if trade.IsOpen() {
+				open = true
+			} else if trade.ClosePositionAt != nil && (closedAt == nil || trade.ClosePositionAt.After(*closedAt)) {
+				closedAt = trade.ClosePositionAt
+			}
+		}
+		sort.Strings(contractMonths)
+
+		status := models.TradeStatusClosed
+		if open {
+			status = models.TradeStatusOpen
+			closedAt = nil
+		} else {
+			rs.closed++
+			if netPnl.IsPositive() {
+				rs.wins++
+			}
+		}
+		rs.tradeCount += len(position.trades)
+		rs.rolls += rolls
+		rs.realizedPnl = rs.realizedPnl.Add(realizedPnl)
+		rs.totalCosts = rs.totalCosts.Add(totalCosts)
+		rs.netPnl = rs.netPnl.Add(netPnl)
+		rs.positions = append(rs.positions, map[string]interface{}{
+			"tradeIds":       tradeIds,
+			"contractMonths": contractMonths,
+			"direction":      position.trades[0].Direction,
+			"status":         status,
+			"rolls":          rolls,
+			"openedAt":       position.trades[0].OpenPositionAt,
+			"closedAt":       closedAt,
+			"realizedPnl":    realizedPnl,
+			"totalCosts":     totalCosts,
+			"netPnl":         netPnl,
+		})
+	}
+
+	sort.Strings(roots)
+	serialized := make([]map[string]interface{}, 0, len(roots))
+	for _, root := range roots {
+		rs := stats[root]
+		var winRate *decimal.Decimal
+		if rs.closed > 0 {
+			value := decimal.NewFromInt(int64(rs.wins)).Div(decimal.NewFromInt(int64(rs.closed))).Shift(2).Round(models.PercentScale)
+			winRate = &value
+		}
+		serialized = append(serialized, map[string]interface{}{
+			"rootSymbol":      root,
+			"positionCount":   len(rs.positions),
+			"tradeCount":      rs.tradeCount,
+			"rolls":           rs.rolls,
+			"contractsClosed": rs.contracts,
+			"winRate":         winRate,
+			"realizedPnl":     rs.realizedPnl,
+			"totalCosts":      rs.totalCosts,
+			"netPnl":          rs.netPnl,
+			"positions":       rs.positions,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"roots": serialized})
+}
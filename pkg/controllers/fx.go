@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm/clause"
+)
+
+// defaultStandardLot is the size of a standard lot of instruments missing
+// from the catalog, 100000 units of the base currency
+const defaultStandardLot = 100000
+
+// fxPivotCurrency is the currency rates are crossed through when the table
+// has no rate between two currencies
+const fxPivotCurrency = "USD"
+
+var errFxRateNotFound = errors.New("no FX rate between the currencies")
+
+// lookUpFxRate returns the rate of the pair closest to the day, preferring
+// the last one on or before it. found is false when the pair has no rates.
+func lookUpFxRate(base string, quote string, at time.Time) (rate decimal.Decimal, found bool, err error) {
+	var rates []models.FxRate
+	result := utils.DB.Where("base_currency = ? AND quote_currency = ?", base, quote).
+		Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "CASE WHEN as_of <= ?::date THEN 0 ELSE 1 END, abs(as_of - ?::date)",
+			Vars: []interface{}{at, at},
+		}}).
+		Limit(1).Find(&rates)
+	if result.Error != nil || len(rates) == 0 {
+		return decimal.Zero, false, result.Error
+	}
+	return rates[0].Rate, true, nil
+}
+
+// findFxRate returns the value of one unit of from in to around the given
+// time, from the direct or inverse pair in the rate table or crossed
+// through the pivot currency
+func findFxRate(from string, to string, at time.Time) (decimal.Decimal, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return decimal.NewFromInt(1), nil
+	}
+	rate, found, err := lookUpFxRate(from, to, at)
+	if err != nil || found {
+		return rate, err
+	}
+	rate, found, err = lookUpFxRate(to, from, at)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if found {
+		return decimal.NewFromInt(1).Div(rate).Round(models.MoneyScale), nil
+	}
+	if from == fxPivotCurrency || to == fxPivotCurrency {
+		return decimal.Zero, errFxRateNotFound
+	}
+
+	toPivot, err := findFxRate(from, fxPivotCurrency, at)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	fromPivot, err := findFxRate(fxPivotCurrency, to, at)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return toPivot.Mul(fromPivot).Round(models.MoneyScale), nil
+}
+
+// ListFxRates returns the FX rate table, optionally only the rates of one
+// base or quote currency and only those on or before asOf
+func ListFxRates(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	tx := utils.DB.Model(&models.FxRate{})
+	if base := query.Get("base"); base != "" {
+		tx = tx.Where("base_currency = ?", strings.ToUpper(base))
+	}
+	if quote := query.Get("quote"); quote != "" {
+		tx = tx.Where("quote_currency = ?", strings.ToUpper(quote))
+	}
+	if asOf := query.Get("asOf"); asOf != "" {
+		day, err := time.Parse(time.DateOnly, asOf)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "asOf must be a date formatted as 2006-01-02"})
+			return
+		}
+		tx = tx.Where("as_of <= ?", day)
+	}
+	var rates []models.FxRate
+	result := tx.Order("base_currency, quote_currency, as_of").Find(&rates)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while listing FX rates"})
+		return
+	}
+
+	serialized := make([]map[string]interface{}, 0, len(rates))
+	for _, rate := range rates {
+		serialized = append(serialized, map[string]interface{}{
+			"base":  rate.BaseCurrency,
+			"quote": rate.QuoteCurrency,
+			"asOf":  rate.AsOf.Format(time.DateOnly),
+			"rate":  rate.Rate,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"rates": serialized})
+}
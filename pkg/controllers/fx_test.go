@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+func TestUpdateForexTrade(t *testing.T) {
+	useTestDB(t)
+	createTestInstrument(t, &models.Instrument{Symbol: "EURUSD", AssetClass: models.AssetClassForex, QuoteCurrency: "USD", ContractMultiplier: decimal.NewFromInt(100000), PipSize: decimal.NewNullDecimal(decimal.RequireFromString("0.0001"))})
+	createTestAccount(t, "account-1", "alice")
+	createTestAccount(t, "account-2", "alice")
+	// The conversion rate was given when the trade was logged
+	trade := &models.Trade{
+		TradId:         "trade-1",
+		UserId:         "alice",
+		AccountId:      "account-1",
+		Asset:          "EURUSD",
+		Status:         models.TradeStatusOpen,
+		Direction:      models.TradeDirectionLong,
+		Quantity:       decimal.NewFromInt(1),
+		Multiplier:     decimal.NewFromInt(100000),
+		OpenPositionAt: time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC),
+		Margin:         decimal.NewFromInt(1000),
+		OpenPrice:      decimal.RequireFromString("1.1"),
+		ForexPosition:  models.ForexPosition{LotSize: models.LotSizeStandard, PipSize: decimal.NewNullDecimal(decimal.RequireFromString("0.0001")), ConversionRate: decimal.RequireFromString("0.9")},
+	}
+	if err := utils.DB.Create(trade).Error; err != nil {
+		t.Fatalf("creating trade: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		multiplier     string
+		conversionRate string
+	}{
+		{"other fields keep the rate", `{"commission": 2}`, "100000", "0.9"},
+		{"lots resize the position", `{"lotSize": "mini"}`, "10000", "0.9"},
+		{"another account looks the rate up again", `{"accountId": "account-2"}`, "10000", "1"},
+		{"a given rate is kept", `{"conversionRate": 0.95}`, "10000", "0.95"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := serveTrade(t, http.MethodPatch, "alice", "trade-1", tt.body)
+			if code != http.StatusOK {
+				t.Fatalf("PATCH status = %d: %v", code, response)
+			}
+			forex := response["forex"].(map[string]interface{})
+			if response["multiplier"] != tt.multiplier || forex["conversionRate"] != tt.conversionRate {
+				t.Errorf("multiplier = %v and conversionRate = %v, want %s and %s", response["multiplier"], forex["conversionRate"], tt.multiplier, tt.conversionRate)
+			}
+		})
+	}
+}
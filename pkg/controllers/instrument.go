@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// findInstrument loads the catalog instrument that the given spelling of a
+// symbol is an alias of
+func findInstrument(symbol string) (*models.Instrument, error) {
+	alias := &models.InstrumentAlias{}
+	result := utils.DB.Where("alias = ?", models.NormalizeSymbol(symbol)).First(alias)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	instrument := &models.Instrument{}
+	result = utils.DB.Preload("Aliases").Where("symbol = ?", alias.Symbol).First(instrument)
+	return instrument, result.Error
+}
+
+// resolveAsset returns the catalog symbol for the asset of a trade. Assets
+// missing from the catalog are kept as entered, only trimmed and upper cased.
+func resolveAsset(asset string) (string, error) {
+	instrument, err := findInstrument(asset)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return strings.ToUpper(strings.TrimSpace(asset)), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return instrument.Symbol, nil
+}
+
+// tradeInstrument is what the asset of a trade resolved to
+type tradeInstrument struct {
+	// Symbol is the asset the trade is stored with
+	Symbol string
+	// Instrument is the catalog entry of the asset, nil when unknown
+	Instrument *models.Instrument
+	// ContractMonth is the delivery month of a futures contract
+	ContractMonth string
+}
+
+// resolveTradeInstrument resolves the asset of a trade against the catalog.
+// Futures contracts such as ESZ4 or ESZ2024 are not in the catalog
+// themselves, they resolve through their root and are stored as root, month
+// code and two digit year (ESZ24). A single digit year is taken as the
+// closest matching year not more than a year before the trade was opened.
+func resolveTradeInstrument(asset string, openedAt time.Time) (*tradeInstrument, error) {
+	instrument, err := findInstrument(asset)
+	if err == nil {
+		return &tradeInstrument{Symbol: instrument.Symbol, Instrument: instrument}, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	unknown := &tradeInstrument{Symbol: strings.ToUpper(strings.TrimSpace(asset))}
+	symbol := models.NormalizeSymbol(asset)
+	digits := len(symbol)
+	for digits > 0 && symbol[digits-1] >= '0' && symbol[digits-1] <= '9' {
+		digits--
+	}
+	yearDigits := symbol[digits:]
+	if digits < 2 || (len(yearDigits) != 1 && len(yearDigits) != 2 && len(yearDigits) != 4) {
+		return unknown, nil
+	}
+	root, code := symbol[:digits-1], symbol[digits-1:digits]
+	month := strings.Index(models.FuturesMonthCodes, code) + 1
+	if month == 0 {
+		return unknown, nil
+	}
+	instrument, err = findInstrument(root)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return unknown, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if instrument.AssetClass != models.AssetClassFuture || (instrument.ContractMonths != "" && !strings.Contains(instrument.ContractMonths, code)) {
+		return unknown, nil
+	}
+
+	year, _ := strconv.Atoi(yearDigits)
+	switch len(yearDigits) {
+	case 1:
+		if openedAt.IsZero() {
+			openedAt = time.Now()
+		}
+		year += openedAt.Year() - openedAt.Year()%10
+		if year < openedAt.Year()-1 {
+			year += 10
+		} else if year-10 >= openedAt.Year()-1 {
+			// Early in a decade the year can still be one of the last
+			year -= 10
+		}
+	case 2:
+		year += 2000
+	}
+	return &tradeInstrument{
+		Symbol:        futuresContractSymbol(instrument.Symbol, year, month),
+		Instrument:    instrument,
+		ContractMonth: fmt.Sprintf("%04d-%02d", year, month),
+	}, nil
+}
+
+// futuresContractSymbol builds the symbol of the futures contract on the
+// root for the delivery month, such as ESZ24
+func futuresContractSymbol(root string, year int, month int) string {
+	return fmt.Sprintf("%s%c%02d", root, models.FuturesMonthCodes[month-1], year%100)
+}
+
+// ListInstruments returns the instrument catalog, optionally only one asset
+// class or the instruments whose symbol or name contain q
+func ListInstruments(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	tx := utils.DB.Model(&models.Instrument{})
+	if assetClass := query.Get("assetClass"); assetClass != "" {
+		tx = tx.Where("asset_class = ?", assetClass)
+	}
+	if search := strings.TrimSpace(query.Get("q")); search != "" {
+		pattern := "%" + strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(search) + "%"
+		tx = tx.Where("symbol ILIKE ? OR name ILIKE ?", pattern, pattern)
+	}
+	var instruments []models.Instrument
+	result := tx.Order("asset_class, symbol").Find(&instruments)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while listing instruments"})
+		return
+	}
+
+	serialized := make([]map[string]interface{}, 0, len(instruments))
+	for _, instrument := range instruments {
+		serialized = append(serialized, serializeInstrument(instrument))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"instruments": serialized})
+}
+
+// GetInstrument returns the instrument the symbol in the path resolves to,
+// so any of its aliases can be used to look it up
+func GetInstrument(w http.ResponseWriter, r *http.Request) {
+	instrument, err := findInstrument(r.PathValue("symbol"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Instrument not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the instrument"})
+		return
+	}
+
+	aliases := make([]string, 0, len(instrument.Aliases))
+	for _, alias := range instrument.Aliases {
+		aliases = append(aliases, alias.Alias)
+	}
+	serialized := serializeInstrument(*instrument)
+	serialized["aliases"] = aliases
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serialized)
+}
+
+// serializeInstrument builds the JSON representation of a catalog instrument
+// returned by the API
+func serializeInstrument(instrument models.Instrument) map[string]interface{} {
+	return map[string]interface{}{
+		"symbol":             instrument.Symbol,
+		"name":               instrument.Name,
+		"assetClass":         instrument.AssetClass,
+		"exchange":           instrument.Exchange,
+		"quoteCurrency":      instrument.QuoteCurrency,
+		"tickSize":           instrument.TickSize,
+		"contractMultiplier": instrument.ContractMultiplier,
+		"pipSize":            instrument.PipSize,
+		"tickValue":          instrument.TickValue(),
+		"contractMonths":     instrument.ContractMonths,
+	}
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+// createTestInstrument stores a catalog instrument with its symbol and the
+// given aliases, which must already be normalized
+func createTestInstrument(t *testing.T, instrument *models.Instrument, aliases ...string) {
+	t.Helper()
+	for _, alias := range append([]string{instrument.Symbol}, aliases...) {
+		instrument.Aliases = append(instrument.Aliases, models.InstrumentAlias{Alias: alias})
+	}
+	if err := utils.DB.Create(instrument).Error; err != nil {
+		t.Fatalf("creating instrument %s: %v", instrument.Symbol, err)
+	}
+}
+
+func TestResolveAsset(t *testing.T) {
+	useTestDB(t)
+	createTestInstrument(t, &models.Instrument{Symbol: "BTCUSD", AssetClass: models.AssetClassCrypto, ContractMultiplier: decimal.NewFromInt(1)}, "XBTUSD")
+
+	tests := []struct {
+		asset string
+		want  string
+	}{
+		{"BTCUSD", "BTCUSD"},
+		{"btc/usd", "BTCUSD"},
+		{"BTC-USD", "BTCUSD"},
+		{"xbtusd", "BTCUSD"},
+		{" aapl ", "AAPL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.asset, func(t *testing.T) {
+			got, err := resolveAsset(tt.asset)
+			if err != nil {
+				t.Fatalf("resolveAsset() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveAsset(%q) = %q, want %q", tt.asset, got, tt.want)
+			}
+		})
+	}
+
+	// Trades are stored under the catalog symbol
+	createTestTrade(t, "trade-1", "alice")
+	code, response := serveTrade(t, http.MethodPatch, "alice", "trade-1", `{"asset": "btc-usd"}`)
+	if code != http.StatusOK || response["asset"] != "BTCUSD" {
+		t.Errorf("PATCH = %d %v, want the asset stored as BTCUSD", code, response["asset"])
+	}
+}
+
+func TestGetInstrument(t *testing.T) {
+	useTestDB(t)
+	createTestInstrument(t, &models.Instrument{Symbol: "EURUSD", AssetClass: models.AssetClassForex, ContractMultiplier: decimal.NewFromInt(100000)})
+
+	tests := []struct {
+		symbol string
+		status int
+	}{
+		{"EURUSD", http.StatusOK},
+		{"eur-usd", http.StatusOK},
+		{"GBPUSD", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.symbol, func(t *testing.T) {
+			r := asUser(httptest.NewRequest(http.MethodGet, "/instrument/"+tt.symbol, nil), "alice")
+			r.SetPathValue("symbol", tt.symbol)
+			w := httptest.NewRecorder()
+			GetInstrument(w, r)
+			if w.Code != tt.status {
+				t.Errorf("GetInstrument() status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestResolveTradeInstrumentContractYear(t *testing.T) {
+	useTestDB(t)
+	createTestInstrument(t, &models.Instrument{Symbol: "ES", AssetClass: models.AssetClassFuture, ContractMultiplier: decimal.NewFromInt(50), ContractMonths: "HMUZ"})
+
+	tests := []struct {
+		name          string
+		asset         string
+		openedAt      time.Time
+		symbol        string
+		contractMonth string
+	}{
+		{"same year", "ESZ4", time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), "ESZ24", "2024-12"},
+		{"year before", "ESH3", time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), "ESH23", "2023-03"},
+		{"two years before rolls to the next decade", "ESH2", time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), "ESH32", "2032-03"},
+		{"start of a decade, last one", "ESZ9", time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC), "ESZ19", "2019-12"},
+		{"start of a decade, earlier in the last one", "ESH8", time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC), "ESH28", "2028-03"},
+		{"end of a decade, next one", "ESH0", time.Date(2029, 11, 20, 0, 0, 0, 0, time.UTC), "ESH30", "2030-03"},
+		{"end of a decade, same year", "ESZ9", time.Date(2029, 11, 20, 0, 0, 0, 0, time.UTC), "ESZ29", "2029-12"},
+		{"end of a decade, year before", "ESM8", time.Date(2029, 11, 20, 0, 0, 0, 0, time.UTC), "ESM28", "2028-06"},
+		{"two digit year", "ESZ24", time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), "ESZ24", "2024-12"},
+		{"four digit year", "ESZ2024", time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), "ESZ24", "2024-12"},
+		{"other spelling", "es z4", time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), "ESZ24", "2024-12"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, err := resolveTradeInstrument(tt.asset, tt.openedAt)
+			if err != nil {
+				t.Fatalf("resolveTradeInstrument() error = %v", err)
+			}
+			if resolved.Symbol != tt.symbol || resolved.ContractMonth != tt.contractMonth {
+				t.Errorf("resolveTradeInstrument(%q, %s) = %s %s, want %s %s", tt.asset, tt.openedAt.Format(time.DateOnly), resolved.Symbol, resolved.ContractMonth, tt.symbol, tt.contractMonth)
+			}
+			if resolved.Instrument == nil || resolved.Instrument.Symbol != "ES" {
+				t.Errorf("Instrument = %v, want ES", resolved.Instrument)
+			}
+		})
+	}
+
+	// Months the root is not listed for are no contract of it
+	resolved, err := resolveTradeInstrument("ESF4", time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("resolveTradeInstrument() error = %v", err)
+	}
+	if resolved.Symbol != "ESF4" || resolved.Instrument != nil || resolved.ContractMonth != "" {
+		t.Errorf("resolveTradeInstrument(ESF4) = %+v, want an unknown asset", resolved)
+	}
+}
+
+func TestUpdateTradeAssetMultiplier(t *testing.T) {
+	useTestDB(t)
+	createTestInstrument(t, &models.Instrument{Symbol: "ES", AssetClass: models.AssetClassFuture, ContractMultiplier: decimal.NewFromInt(50), ContractMonths: "HMUZ"})
+	createTestTrade(t, "trade-1", "alice")
+	createTestTrade(t, "trade-2", "alice")
+
+	// A futures contract replacing a stock brings the point value of its root
+	code, response := serveTrade(t, http.MethodPatch, "alice", "trade-1", `{"asset": "ESZ4"}`)
+	if code != http.StatusOK || response["asset"] != "ESZ24" || response["multiplier"] != "50" {
+		t.Errorf("PATCH asset = %d %v, want ESZ24 with multiplier 50", code, response)
+	}
+	// Unless the payload sets one itself
+	code, response = serveTrade(t, http.MethodPatch, "alice", "trade-2", `{"asset": "ESZ4", "multiplier": 5}`)
+	if code != http.StatusOK || response["multiplier"] != "5" {
+		t.Errorf("PATCH asset and multiplier = %d %v, want multiplier 5", code, response)
+	}
+	// Other fields leave the stored multiplier alone
+	code, response = serveTrade(t, http.MethodPatch, "alice", "trade-2", `{"notes": "rolled"}`)
+	if code != http.StatusOK || response["multiplier"] != "5" {
+		t.Errorf("PATCH without asset = %d %v, want multiplier 5", code, response)
+	}
+}
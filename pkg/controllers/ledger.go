@@ -0,0 +1,321 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// LedgerHandler dispatches /account/{id}/ledger to the handler for the request method
+func LedgerHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ListLedgerEntries(w, r)
+	case http.MethodPost:
+		AddLedgerEntry(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func ListLedgerEntries(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	account, err := findUserAccount(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Account not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the account"})
+		return
+	}
+
+	var entries []models.LedgerEntry
+	result := utils.DB.Where("account_id = ?", account.AccountId).Order("occurred_at, id").Find(&entries)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while listing ledger entries"})
+		return
+	}
+
+	serialized := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		serialized = append(serialized, serializeLedgerEntry(entry))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"entries": serialized})
+}
+
+// AddLedgerEntry records a cash movement on the account. Deposits, interest
+// and dividends take a positive amount, withdrawals take a positive amount
+// that is stored as money leaving the account, adjustments take a signed one.
+func AddLedgerEntry(w http.ResponseWriter, r *http.Request) {
+	type FormData struct {
+		EntryType  string          `json:"entryType"`
+		Amount     decimal.Decimal `json:"amount"`
+		OccurredAt time.Time       `json:"occurredAt"`
+		Note       string          `json:"note"`
+	}
+
+	userId, _ := r.Context().Value("username").(string)
+	account, err := findUserAccount(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Account not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the account"})
+		return
+	}
+
+	var data FormData
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+
+	// Validate required fields
+	amount := data.Amount
+	switch data.EntryType {
+	case models.LedgerEntryDeposit, models.LedgerEntryInterest, models.LedgerEntryDividend:
+		if amount.Sign() <= 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "Amount must be greater than 0"})
+			return
+		}
+	case models.LedgerEntryWithdrawal:
+		if amount.Sign() <= 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "Amount must be greater than 0"})
+			return
+		}
+		amount = amount.Neg()
+	case models.LedgerEntryAdjustment:
+		if amount.IsZero() {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "Amount must not be 0"})
+			return
+		}
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "EntryType must be deposit, withdrawal, interest, dividend or adjustment"})
+		return
+	}
+	if data.OccurredAt.IsZero() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "OccurredAt is required"})
+		return
+	}
+
+	entry := &models.LedgerEntry{
+		EntryId:    uuid.New().String(),
+		AccountId:  account.AccountId,
+		UserId:     userId,
+		EntryType:  data.EntryType,
+		Amount:     amount,
+		OccurredAt: data.OccurredAt,
+		Note:       data.Note,
+	}
+	result := utils.DB.Create(entry)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while adding the ledger entry"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializeLedgerEntry(*entry))
+}
+
+func DeleteLedgerEntry(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	entry := &models.LedgerEntry{}
+	result := utils.DB.Where("entry_id = ? AND account_id = ? AND user_id = ?", r.PathValue("entryId"), r.PathValue("id"), userId).First(entry)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Ledger entry not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the ledger entry"})
+		return
+	}
+
+	result = utils.DB.Delete(entry)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while deleting the ledger entry"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// balancePoint is the state of an account at the end of a day
+type balancePoint struct {
+	Date time.Time
+	// Flows are the deposits, withdrawals and adjustments of the day
+	Flows decimal.Decimal
+	// Pnl is the net P&L of trades closed that day plus interest and dividends
+	Pnl         decimal.Decimal
+	Balance     decimal.Decimal
+	DailyReturn decimal.Decimal
+}
+
+// accountBalanceSeries combines the account's ledger with the net P&L of its
+// closed trades into a daily running balance, starting from StartingBalance.
+// Days are UTC calendar days. Flows are assumed to land at the start of the
+// day, so a day's return is its P&L over the previous balance plus its flows.
+func accountBalanceSeries(account *models.Account) ([]balancePoint, error) {
+	var days []struct {
+		Day   time.Time
+		Flows decimal.Decimal
+		Pnl   decimal.Decimal
+	}
+	result := utils.DB.Raw(`SELECT day, SUM(flows) AS flows, SUM(pnl) AS pnl FROM (
+		SELECT date_trunc('day', occurred_at AT TIME ZONE 'UTC') AS day,
+			CASE WHEN entry_type IN @income THEN 0 ELSE amount END AS flows,
+			CASE WHEN entry_type IN @income THEN amount ELSE 0 END AS pnl
+		FROM ledger_entries WHERE account_id = @account AND deleted_at IS NULL
+		UNION ALL
+		SELECT date_trunc('day', close_position_at AT TIME ZONE 'UTC') AS day, 0 AS flows, net_pnl AS pnl
+		FROM trades WHERE account_id = @account AND status = @closed AND deleted_at IS NULL
+	) movements GROUP BY day ORDER BY day`,
+		map[string]interface{}{
+			"account": account.AccountId,
+			"income":  models.LedgerIncomeTypes,
+			"closed":  models.TradeStatusClosed,
+		}).Scan(&days)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	series := make([]balancePoint, 0, len(days))
+	balance := account.StartingBalance
+	for _, day := range days {
+		point := balancePoint{Date: day.Day, Flows: day.Flows, Pnl: day.Pnl}
+		invested := balance.Add(day.Flows)
+		if invested.IsPositive() {
+			point.DailyReturn = day.Pnl.Div(invested).Round(models.MoneyScale)
+		}
+		balance = invested.Add(day.Pnl)
+		point.Balance = balance
+		series = append(series, point)
+	}
+	return series, nil
+}
+
+// timeWeightedReturn chains the daily returns of a balance series, in percent
+func timeWeightedReturn(series []balancePoint) decimal.Decimal {
+	growth := decimal.NewFromInt(1)
+	for _, point := range series {
+		growth = growth.Mul(decimal.NewFromInt(1).Add(point.DailyReturn)).Round(models.MoneyScale)
+	}
+	return growth.Sub(decimal.NewFromInt(1)).Shift(2).Round(models.PercentScale)
+}
+
+// GetAccountBalance returns the account's daily running balance and its
+// time-weighted return, which is not distorted by deposits and withdrawals
+func GetAccountBalance(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	account, err := findUserAccount(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Account not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the account"})
+		return
+	}
+
+	series, err := accountBalanceSeries(account)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing the account balance"})
+		return
+	}
+
+	balance := account.StartingBalance
+	var netFlows, pnl decimal.Decimal
+	serialized := make([]map[string]interface{}, 0, len(series))
+	for _, point := range series {
+		netFlows = netFlows.Add(point.Flows)
+		pnl = pnl.Add(point.Pnl)
+		balance = point.Balance
+		serialized = append(serialized, map[string]interface{}{
+			"date":        point.Date.Format(time.DateOnly),
+			"flows":       point.Flows,
+			"pnl":         point.Pnl,
+			"balance":     point.Balance,
+			"dailyReturn": point.DailyReturn.Shift(2).Round(models.PercentScale),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"accountId":          account.AccountId,
+		"baseCurrency":       account.BaseCurrency,
+		"startingBalance":    account.StartingBalance,
+		"netFlows":           netFlows,
+		"pnl":                pnl,
+		"balance":            balance,
+		"timeWeightedReturn": timeWeightedReturn(series),
+		"series":             serialized,
+	})
+}
+
+// serializeLedgerEntry builds the JSON representation of a ledger entry returned by the API
+func serializeLedgerEntry(entry models.LedgerEntry) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         entry.EntryId,
+		"accountId":  entry.AccountId,
+		"entryType":  entry.EntryType,
+		"amount":     entry.Amount,
+		"occurredAt": entry.OccurredAt,
+		"note":       entry.Note,
+		"createdAt":  entry.CreatedAt,
+	}
+}
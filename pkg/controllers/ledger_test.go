@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestAddLedgerEntry(t *testing.T) {
+	useTestDB(t)
+	createTestAccount(t, "account-1", "alice")
+
+	tests := []struct {
+		name   string
+		userId string
+		body   string
+		status int
+		amount string
+	}{
+		{"deposit", "alice", `{"entryType": "deposit", "amount": 500, "occurredAt": "2024-03-01T00:00:00Z"}`, http.StatusCreated, "500"},
+		{"withdrawal leaves the account", "alice", `{"entryType": "withdrawal", "amount": 200, "occurredAt": "2024-03-02T00:00:00Z"}`, http.StatusCreated, "-200"},
+		{"negative adjustment", "alice", `{"entryType": "adjustment", "amount": -5, "occurredAt": "2024-03-03T00:00:00Z"}`, http.StatusCreated, "-5"},
+		{"negative deposit", "alice", `{"entryType": "deposit", "amount": -500, "occurredAt": "2024-03-01T00:00:00Z"}`, http.StatusBadRequest, ""},
+		{"zero adjustment", "alice", `{"entryType": "adjustment", "amount": 0, "occurredAt": "2024-03-01T00:00:00Z"}`, http.StatusBadRequest, ""},
+		{"unknown type", "alice", `{"entryType": "bonus", "amount": 5, "occurredAt": "2024-03-01T00:00:00Z"}`, http.StatusBadRequest, ""},
+		{"missing date", "alice", `{"entryType": "deposit", "amount": 500}`, http.StatusBadRequest, ""},
+		{"another user", "bob", `{"entryType": "deposit", "amount": 500, "occurredAt": "2024-03-01T00:00:00Z"}`, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := asUser(httptest.NewRequest(http.MethodPost, "/account/account-1/ledger", strings.NewReader(tt.body)), tt.userId)
+			r.SetPathValue("id", "account-1")
+			w := httptest.NewRecorder()
+			LedgerHandler(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("AddLedgerEntry() status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.amount == "" {
+				return
+			}
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+			}
+			if response["amount"] != tt.amount {
+				t.Errorf("amount = %v, want %s", response["amount"], tt.amount)
+			}
+		})
+	}
+}
+
+func TestTimeWeightedReturn(t *testing.T) {
+	dec := decimal.RequireFromString
+	tests := []struct {
+		name    string
+		returns []string
+		want    string
+	}{
+		{"no days", nil, "0"},
+		{"one day", []string{"0.1"}, "10"},
+		{"gain then loss", []string{"0.1", "-0.1"}, "-1"},
+		{"compounded", []string{"0.05", "0.05", "0.05"}, "15.7625"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var series []balancePoint
+			for _, dailyReturn := range tt.returns {
+				series = append(series, balancePoint{DailyReturn: dec(dailyReturn)})
+			}
+			if got := timeWeightedReturn(series); !got.Equal(dec(tt.want)) {
+				t.Errorf("timeWeightedReturn() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
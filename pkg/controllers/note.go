@@ -0,0 +1,371 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// NoteHandler dispatches /note to the handler for the request method
+func NoteHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ListNotes(w, r)
+	case http.MethodPost:
+		AddNote(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// NoteDetailHandler dispatches /note/{id} to the handler for the request method
+func NoteDetailHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		GetNote(w, r)
+	case http.MethodPut, http.MethodPatch:
+		UpdateNote(w, r)
+	case http.MethodDelete:
+		DeleteNote(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// findUserNote loads the note with the given NoteId owned by the user. Notes
+// belonging to someone else are reported as not found.
+func findUserNote(noteId string, userId string) (*models.Note, error) {
+	note := &models.Note{}
+	result := utils.DB.Where("note_id = ? AND user_id = ?", noteId, userId).First(note)
+	return note, result.Error
+}
+
+// findTradeNotes loads the notes attached to a trade, oldest first
+func findTradeNotes(tradeId string, userId string) ([]models.Note, error) {
+	var notes []models.Note
+	result := utils.DB.Where("trad_id = ? AND user_id = ?", tradeId, userId).Order("created_at, id").Find(&notes)
+	return notes, result.Error
+}
+
+// ListNotes returns the caller's notes. They can be narrowed down to one
+// trade with tradeId, to one day with day, or to a range of days with from
+// and to. Days are formatted as 2006-01-02.
+func ListNotes(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	query := r.URL.Query()
+
+	tx := utils.DB.Where("user_id = ?", userId)
+	if tradeId := query.Get("tradeId"); tradeId != "" {
+		tx = tx.Where("trad_id = ?", tradeId)
+	}
+	dayFilters := []struct {
+		param string
+		cond  string
+	}{
+		{"day", "day = ?"},
+		{"from", "day >= ?"},
+		{"to", "day <= ?"},
+	}
+	for _, filter := range dayFilters {
+		value := query.Get(filter.param)
+		if value == "" {
+			continue
+		}
+		day, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": filter.param + " must be a date formatted as 2006-01-02"})
+			return
+		}
+		tx = tx.Where(filter.cond, day)
+	}
+
+	var notes []models.Note
+	result := tx.Order("day DESC NULLS LAST, created_at DESC, id DESC").Find(&notes)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while listing notes"})
+		return
+	}
+
+	serialized := make([]map[string]interface{}, 0, len(notes))
+	for _, note := range notes {
+		serialized = append(serialized, serializeNote(note))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"notes": serialized})
+}
+
+// AddNote attaches a Markdown note to either one of the caller's trades or
+// to a calendar day, never both
+func AddNote(w http.ResponseWriter, r *http.Request) {
+	type FormData struct {
+		TradeId string `json:"tradeId"`
+		Day     string `json:"day"`
+		Body    string `json:"body"`
+	}
+
+	var data FormData
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+
+	// Validate required fields
+	if (data.TradeId == "") == (data.Day == "") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Exactly one of tradeId and day is required"})
+		return
+	}
+	if strings.TrimSpace(data.Body) == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Body is required"})
+		return
+	}
+
+	userId, _ := r.Context().Value("username").(string)
+	note := &models.Note{
+		NoteId: uuid.New().String(),
+		UserId: userId,
+		Body:   data.Body,
+	}
+	if data.TradeId != "" {
+		var count int64
+		result := utils.DB.Model(&models.Trade{}).Where("trad_id = ? AND user_id = ?", data.TradeId, userId).Count(&count)
+		if result.Error != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while adding the note"})
+			return
+		}
+		if count == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		note.TradId = data.TradeId
+	} else {
+		day, err := time.Parse(time.DateOnly, data.Day)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "Day must be a date formatted as 2006-01-02"})
+			return
+		}
+		note.Day = &day
+	}
+
+	result := utils.DB.Create(note)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while adding the note"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializeNote(*note))
+}
+
+func GetNote(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	note, err := findUserNote(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Note not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the note"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serializeNote(*note))
+}
+
+// UpdateNote replaces the body of a note and keeps the previous body as a
+// revision. What a note is attached to cannot be changed.
+func UpdateNote(w http.ResponseWriter, r *http.Request) {
+	type FormData struct {
+		Body string `json:"body"`
+	}
+
+	userId, _ := r.Context().Value("username").(string)
+	note, err := findUserNote(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Note not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the note"})
+		return
+	}
+
+	// PATCH starts from the stored values, PUT from an empty form
+	var data FormData
+	if r.Method == http.MethodPatch {
+		data = FormData{Body: note.Body}
+	}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+	if strings.TrimSpace(data.Body) == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Body is required"})
+		return
+	}
+
+	// Saving the same body again does not make a new revision
+	if data.Body != note.Body {
+		revision := &models.NoteRevision{NoteId: note.NoteId, Body: note.Body}
+		note.Body = data.Body
+		err = utils.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(revision).Error; err != nil {
+				return err
+			}
+			return tx.Save(note).Error
+		})
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while updating the note"})
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serializeNote(*note))
+}
+
+// DeleteNote soft deletes the note. Its revisions are kept with it.
+func DeleteNote(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	note, err := findUserNote(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Note not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the note"})
+		return
+	}
+
+	result := utils.DB.Delete(note)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while deleting the note"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetNoteHistory returns the previous bodies of a note, newest first
+func GetNoteHistory(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	note, err := findUserNote(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Note not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the note"})
+		return
+	}
+
+	var revisions []models.NoteRevision
+	result := utils.DB.Where("note_id = ?", note.NoteId).Order("created_at DESC, id DESC").Find(&revisions)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the note history"})
+		return
+	}
+
+	serialized := make([]map[string]interface{}, 0, len(revisions))
+	for _, revision := range revisions {
+		serialized = append(serialized, map[string]interface{}{
+			"body": revision.Body,
+			"html": utils.RenderMarkdown(revision.Body),
+			// A revision is the body as it was until it was replaced
+			"replacedAt": revision.CreatedAt,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"note": serializeNote(*note), "revisions": serialized})
+}
+
+// serializeNote builds the JSON representation of a note returned by the
+// API. The Markdown body is returned along with its sanitized HTML rendering.
+func serializeNote(note models.Note) map[string]interface{} {
+	var day *string
+	if note.Day != nil {
+		formatted := note.Day.Format(time.DateOnly)
+		day = &formatted
+	}
+	var tradeId *string
+	if note.TradId != "" {
+		tradeId = &note.TradId
+	}
+	return map[string]interface{}{
+		"id":        note.NoteId,
+		"tradeId":   tradeId,
+		"day":       day,
+		"body":      note.Body,
+		"html":      utils.RenderMarkdown(note.Body),
+		"createdAt": note.CreatedAt,
+		"updatedAt": note.UpdatedAt,
+	}
+}
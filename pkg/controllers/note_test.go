@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveNote runs the handler for the user and decodes the JSON response
+func serveNote(t *testing.T, handler http.HandlerFunc, method string, userId string, noteId string, body string) (int, map[string]interface{}) {
+	t.Helper()
+	r := asUser(httptest.NewRequest(method, "/note/"+noteId, strings.NewReader(body)), userId)
+	r.SetPathValue("id", noteId)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	var response map[string]interface{}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code, response
+}
+
+func TestAddNote(t *testing.T) {
+	useTestDB(t)
+	createTestTrade(t, "trade-1", "alice")
+	createTestTrade(t, "trade-2", "bob")
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"trade note", `{"tradeId": "trade-1", "body": "Entered on the retest"}`, http.StatusCreated},
+		{"day note", `{"day": "2024-03-04", "body": "Slept badly"}`, http.StatusCreated},
+		{"both trade and day", `{"tradeId": "trade-1", "day": "2024-03-04", "body": "Both"}`, http.StatusBadRequest},
+		{"neither trade nor day", `{"body": "Nothing"}`, http.StatusBadRequest},
+		{"blank body", `{"day": "2024-03-04", "body": "  "}`, http.StatusBadRequest},
+		{"another user's trade", `{"tradeId": "trade-2", "body": "Not mine"}`, http.StatusBadRequest},
+		{"invalid day", `{"day": "04/03/2024", "body": "Wrong format"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, response := serveNote(t, NoteHandler, http.MethodPost, "alice", "", tt.body); code != tt.status {
+				t.Errorf("AddNote() status = %d, want %d: %v", code, tt.status, response)
+			}
+		})
+	}
+}
+
+func TestNoteRevisions(t *testing.T) {
+	useTestDB(t)
+	createTestUser(t, "alice")
+	code, response := serveNote(t, NoteHandler, http.MethodPost, "alice", "", `{"day": "2024-03-04", "body": "First"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("AddNote() status = %d: %v", code, response)
+	}
+	noteId := response["id"].(string)
+
+	for _, body := range []string{`{"body": "Second"}`, `{"body": "Second"}`, `{"body": "**Third**"}`} {
+		if code, response := serveNote(t, NoteDetailHandler, http.MethodPatch, "alice", noteId, body); code != http.StatusOK {
+			t.Fatalf("UpdateNote() status = %d: %v", code, response)
+		}
+	}
+	if code, response := serveNote(t, NoteDetailHandler, http.MethodPatch, "bob", noteId, `{"body": "Mine now"}`); code != http.StatusNotFound {
+		t.Errorf("UpdateNote() by another user status = %d, want %d: %v", code, http.StatusNotFound, response)
+	}
+
+	code, response = serveNote(t, GetNoteHistory, http.MethodGet, "alice", noteId, "")
+	if code != http.StatusOK {
+		t.Fatalf("GetNoteHistory() status = %d: %v", code, response)
+	}
+	note := response["note"].(map[string]interface{})
+	if note["body"] != "**Third**" || note["html"] != "<p><strong>Third</strong></p>\n" {
+		t.Errorf("note = %v, want the latest body rendered", note)
+	}
+	// Saving the same body twice only keeps one revision of it
+	revisions := response["revisions"].([]interface{})
+	bodies := []string{}
+	for _, revision := range revisions {
+		bodies = append(bodies, revision.(map[string]interface{})["body"].(string))
+	}
+	if strings.Join(bodies, ",") != "Second,First" {
+		t.Errorf("revisions = %v, want [Second First]", bodies)
+	}
+}
@@ -0,0 +1,482 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OptionStrategyHandler dispatches /option-strategy to the handler for the
+// request method
+func OptionStrategyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ListOptionStrategies(w, r)
+	case http.MethodPost:
+		AddOptionStrategy(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// OptionStrategyDetailHandler dispatches /option-strategy/{id} to the
+// handler for the request method
+func OptionStrategyDetailHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		GetOptionStrategy(w, r)
+	case http.MethodPut, http.MethodPatch:
+		UpdateOptionStrategy(w, r)
+	case http.MethodDelete:
+		DeleteOptionStrategy(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// optionStrategyForm maps the payload accepted by AddOptionStrategy and
+// UpdateOptionStrategy
+type optionStrategyForm struct {
+	Name         string `json:"name"`
+	StrategyType string `json:"strategyType"`
+	Underlying   string `json:"underlying"`
+}
+
+// validate returns the error message for the first invalid field, or an
+// empty string when the form is valid
+func (data optionStrategyForm) validate() string {
+	if data.Name == "" {
+		return "Name is required"
+	}
+	if !slices.Contains(models.OptionStrategyTypes, data.StrategyType) {
+		return "StrategyType is not a known option strategy"
+	}
+	return ""
+}
+
+// orderLegs sorts the preloaded legs of an option strategy by entry
+func orderLegs(db *gorm.DB) *gorm.DB {
+	return db.Order("open_position_at, id")
+}
+
+// findUserOptionStrategy loads the option strategy with the given
+// StrategyId owned by the user, along with its legs
+func findUserOptionStrategy(strategyId string, userId string) (*models.OptionStrategy, error) {
+	strategy := &models.OptionStrategy{}
+	result := utils.DB.Preload("Legs", orderLegs).Where("strategy_id = ? AND user_id = ?", strategyId, userId).First(strategy)
+	return strategy, result.Error
+}
+
+// ListOptionStrategies returns the caller's option strategies with their
+// legs and combined figures
+func ListOptionStrategies(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+
+	tx := utils.DB.Preload("Legs", orderLegs).Where("user_id = ?", userId)
+	if underlying := r.URL.Query().Get("underlying"); underlying != "" {
+		tx = tx.Where("underlying = ?", underlying)
+	}
+	var strategies []models.OptionStrategy
+	result := tx.Order("created_at DESC, id DESC").Find(&strategies)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while listing option strategies"})
+		return
+	}
+
+	serialized := make([]map[string]interface{}, 0, len(strategies))
+	for _, strategy := range strategies {
+		serialized = append(serialized, serializeOptionStrategy(strategy))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"optionStrategies": serialized})
+}
+
+// AddOptionStrategy creates an empty option strategy. Legs are added to it
+// by setting optionStrategyId on trades.
+func AddOptionStrategy(w http.ResponseWriter, r *http.Request) {
+	// Strategies are custom unless stated otherwise
+	data := optionStrategyForm{StrategyType: models.OptionStrategyCustom}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+
+	// Validate required fields
+	if message := data.validate(); message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+	underlying, err := resolveAsset(data.Underlying)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while resolving the underlying"})
+		return
+	}
+
+	userId, _ := r.Context().Value("username").(string)
+	strategy := &models.OptionStrategy{
+		StrategyId:   uuid.New().String(),
+		UserId:       userId,
+		Name:         data.Name,
+		StrategyType: data.StrategyType,
+		Underlying:   underlying,
+	}
+	result := utils.DB.Create(strategy)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while adding the option strategy"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializeOptionStrategy(*strategy))
+}
+
+func GetOptionStrategy(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	strategy, err := findUserOptionStrategy(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Option strategy not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the option strategy"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serializeOptionStrategy(*strategy))
+}
+
+// UpdateOptionStrategy replaces the option strategy on PUT and merges the
+// payload into it on PATCH
+func UpdateOptionStrategy(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	strategy, err := findUserOptionStrategy(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Option strategy not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the option strategy"})
+		return
+	}
+
+	// PATCH starts from the stored values, PUT from an empty form
+	data := optionStrategyForm{StrategyType: models.OptionStrategyCustom}
+	if r.Method == http.MethodPatch {
+		data = optionStrategyForm{Name: strategy.Name, StrategyType: strategy.StrategyType, Underlying: strategy.Underlying}
+	}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+	if message := data.validate(); message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+	underlying, err := resolveAsset(data.Underlying)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while resolving the underlying"})
+		return
+	}
+
+	strategy.Name = data.Name
+	strategy.StrategyType = data.StrategyType
+	strategy.Underlying = underlying
+	result := utils.DB.Omit(clause.Associations).Save(strategy)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while updating the option strategy"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serializeOptionStrategy(*strategy))
+}
+
+// DeleteOptionStrategy soft deletes the option strategy. Its legs are kept
+// as standalone trades.
+func DeleteOptionStrategy(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	strategy, err := findUserOptionStrategy(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Option strategy not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the option strategy"})
+		return
+	}
+
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Trade{}).Where("option_strategy_id = ?", strategy.StrategyId).Update("option_strategy_id", "").Error; err != nil {
+			return err
+		}
+		return tx.Delete(strategy).Error
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while deleting the option strategy"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExpireOption settles an open option at expiration. Whatever is still open
+// is closed at a price of zero, keeping the premium as the P&L of the option.
+// Assigned and exercised options also open the resulting position in the
+// underlying at the strike, linked to the option through ParentTradId.
+func ExpireOption(w http.ResponseWriter, r *http.Request) {
+	type FormData struct {
+		Outcome   string    `json:"outcome"`
+		SettledAt time.Time `json:"settledAt"`
+	}
+
+	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+	if !trade.IsOption() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Trade is not an option"})
+		return
+	}
+	if !trade.IsOpen() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Trade is already closed"})
+		return
+	}
+
+	var data FormData
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+
+	// Only long options are exercised and only short options are assigned
+	var message string
+	switch data.Outcome {
+	case models.OptionExpired:
+	case models.OptionExercised:
+		if trade.Direction != models.TradeDirectionLong {
+			message = "Only long options can be exercised"
+		}
+	case models.OptionAssigned:
+		if trade.Direction != models.TradeDirectionShort {
+			message = "Only short options can be assigned"
+		}
+	default:
+		message = "Outcome must be expired, exercised or assigned"
+	}
+	if data.SettledAt.IsZero() {
+		data.SettledAt = time.Now()
+	}
+	if message == "" && data.SettledAt.Before(trade.OpenPositionAt) {
+		message = "SettledAt must not be before OpenPositionAt"
+	}
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+
+	openQuantity := trade.Quantity.Sub(trade.ExitedQuantity)
+	var executions []models.Execution
+	if len(trade.Executions) > 0 {
+		executions, err = prepareTradeExecution(trade, models.Execution{
+			Side:       oppositeSide(trade.EntrySide()),
+			Quantity:   openQuantity,
+			Price:      decimal.Zero,
+			ExecutedAt: data.SettledAt,
+		})
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+	} else {
+		settledAt := data.SettledAt
+		trade.Status = models.TradeStatusClosed
+		trade.ClosePositionAt = &settledAt
+		trade.ClosePrice = decimal.Zero
+		trade.ExitedQuantity = trade.Quantity
+		trade.ComputePnl()
+	}
+	trade.ExpirationOutcome = data.Outcome
+
+	// Exercising a call or being assigned a put buys the underlying, the
+	// other way around sells it
+	var position *models.Trade
+	if data.Outcome != models.OptionExpired {
+		direction := models.TradeDirectionShort
+		if (trade.OptionType == models.OptionTypeCall) == (trade.Direction == models.TradeDirectionLong) {
+			direction = models.TradeDirectionLong
+		}
+		quantity := openQuantity.Mul(trade.ContractMultiplier())
+		position = &models.Trade{
+			TradId:         uuid.New().String(),
+			UserId:         trade.UserId,
+			AccountId:      trade.AccountId,
+			ParentTradId:   trade.TradId,
+			Asset:          trade.Underlying,
+			Status:         models.TradeStatusOpen,
+			Direction:      direction,
+			Quantity:       quantity,
+			Multiplier:     decimal.NewFromInt(1),
+			OpenPositionAt: data.SettledAt,
+			OpenPrice:      trade.Strike.Decimal,
+			Margin:         trade.Strike.Decimal.Mul(quantity),
+		}
+		position.ComputePnl()
+	}
+
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		if len(executions) > 0 {
+			if err := tx.Create(&executions).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Omit(clause.Associations).Save(trade).Error; err != nil {
+			return err
+		}
+		if position != nil {
+			return tx.Create(position).Error
+		}
+		return nil
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while settling the option"})
+		return
+	}
+
+	resp := map[string]interface{}{
+		"option":   serializeTrade(*trade),
+		"position": nil,
+	}
+	if position != nil {
+		resp["position"] = serializeTrade(*position)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// serializeOptionStrategy builds the JSON representation of an option
+// strategy returned by the API, with its legs and the figures of the
+// position as a whole
+func serializeOptionStrategy(strategy models.OptionStrategy) map[string]interface{} {
+	legs := make([]map[string]interface{}, 0, len(strategy.Legs))
+	var realizedPnl, totalCosts, netPnl decimal.Decimal
+	openLegs := 0
+	for _, leg := range strategy.Legs {
+		legs = append(legs, serializeTrade(leg))
+		realizedPnl = realizedPnl.Add(leg.RealizedPnl)
+		totalCosts = totalCosts.Add(leg.TotalCosts())
+		netPnl = netPnl.Add(leg.NetPnl)
+		if leg.IsOpen() {
+			openLegs++
+		}
+	}
+	status := models.TradeStatusClosed
+	if openLegs > 0 || len(strategy.Legs) == 0 {
+		status = models.TradeStatusOpen
+	}
+
+	maxRisk, maxProfit := strategy.RiskProfile()
+	var returnOnRisk *decimal.Decimal
+	if maxRisk.Valid && maxRisk.Decimal.IsPositive() {
+		value := netPnl.Div(maxRisk.Decimal).Shift(2).Round(models.PercentScale)
+		returnOnRisk = &value
+	}
+	return map[string]interface{}{
+		"id":           strategy.StrategyId,
+		"name":         strategy.Name,
+		"strategyType": strategy.StrategyType,
+		"underlying":   strategy.Underlying,
+		"status":       status,
+		"openLegs":     openLegs,
+		"netPremium":   strategy.NetPremium(),
+		"realizedPnl":  realizedPnl,
+		"totalCosts":   totalCosts,
+		"netPnl":       netPnl,
+		"maxRisk":      maxRisk,
+		"maxProfit":    maxProfit,
+		"returnOnRisk": returnOnRisk,
+		"legs":         legs,
+		"createdAt":    strategy.CreatedAt,
+	}
+}
@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// computeCrossLiquidation updates the LiquidationPrice of a cross margin
+// trade against the current balance of its account, which backs every
+// position in it. Trades without an account only have their own margin.
+func computeCrossLiquidation(trade *models.Trade) error {
+	if !trade.IsLeveraged() || trade.MarginMode != models.MarginModeCross {
+		return nil
+	}
+	collateral := trade.Margin
+	if trade.AccountId != "" {
+		account := &models.Account{}
+		result := utils.DB.Where("account_id = ?", trade.AccountId).First(account)
+		if result.Error != nil {
+			return result.Error
+		}
+		series, err := accountBalanceSeries(account)
+		if err != nil {
+			return err
+		}
+		collateral = account.StartingBalance
+		if len(series) > 0 {
+			collateral = series[len(series)-1].Balance
+		}
+	}
+	trade.LiquidationPrice = trade.LiquidationPriceFor(collateral)
+	return nil
+}
+
+// fundingPaymentTotal sums the funding payments of the trade. paid is false
+// when the trade has none, its Funding is then entered by hand.
+func fundingPaymentTotal(tx *gorm.DB, tradeId string) (total decimal.Decimal, paid bool, err error) {
+	var sum struct {
+		Count  int64
+		Amount decimal.Decimal
+	}
+	result := tx.Model(&models.FundingPayment{}).Where("trad_id = ?", tradeId).
+		Select("COUNT(*) AS count, COALESCE(SUM(amount), 0) AS amount").Scan(&sum)
+	return sum.Amount, sum.Count > 0, result.Error
+}
+
+// syncTradeFunding sets the Funding of the trade to the sum of its funding
+// payments and saves it with its P&L recomputed
+func syncTradeFunding(tx *gorm.DB, trade *models.Trade) error {
+	total, _, err := fundingPaymentTotal(tx, trade.TradId)
+	if err != nil {
+		return err
+	}
+	trade.Funding = total
+	trade.ComputePnl()
+	return tx.Omit(clause.Associations).Save(trade).Error
+}
+
+// splitFundingPayments moves the share of every funding payment that belongs
+// to a part of the position closed out into a payment of the closed trade,
+// so the payments of both trades keep adding up to their Funding. It returns
+// the moved payments and their total.
+func splitFundingPayments(payments []models.FundingPayment, closedTradId string, share func(decimal.Decimal) decimal.Decimal) ([]models.FundingPayment, decimal.Decimal) {
+	moved := make([]models.FundingPayment, 0, len(payments))
+	total := decimal.Zero
+	for i := range payments {
+		part := models.FundingPayment{
+			PaymentId: uuid.New().String(),
+			TradId:    closedTradId,
+			UserId:    payments[i].UserId,
+			Rate:      payments[i].Rate,
+			MarkPrice: payments[i].MarkPrice,
+			Amount:    share(payments[i].Amount),
+			PaidAt:    payments[i].PaidAt,
+		}
+		payments[i].Amount = payments[i].Amount.Sub(part.Amount)
+		total = total.Add(part.Amount)
+		moved = append(moved, part)
+	}
+	return moved, total
+}
+
+// FundingHandler dispatches /trade/{id}/funding to the handler for the request method
+func FundingHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ListFundingPayments(w, r)
+	case http.MethodPost:
+		AddFundingPayment(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func ListFundingPayments(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+
+	var payments []models.FundingPayment
+	result := utils.DB.Where("trad_id = ?", trade.TradId).Order("paid_at, id").Find(&payments)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while listing funding payments"})
+		return
+	}
+
+	serialized := make([]map[string]interface{}, 0, len(payments))
+	for _, payment := range payments {
+		serialized = append(serialized, serializeFundingPayment(payment))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"payments": serialized})
+}
+
+// AddFundingPayment records a funding payment on the trade and accrues it to
+// the trade's funding costs, which are the sum of its payments from then on.
+// The amount is either given, positive when paid, or computed from the
+// funding rate and the mark price at the funding time: longs pay shorts when
+// the rate is positive and the other way around when it is negative.
+func AddFundingPayment(w http.ResponseWriter, r *http.Request) {
+	type FormData struct {
+		Amount    decimal.NullDecimal `json:"amount"`
+		Rate      decimal.NullDecimal `json:"rate"`
+		MarkPrice decimal.NullDecimal `json:"markPrice"`
+		PaidAt    time.Time           `json:"paidAt"`
+	}
+
+	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+
+	var data FormData
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+
+	// Validate required fields
+	var message string
+	switch {
+	case data.PaidAt.IsZero():
+		message = "PaidAt is required"
+	case data.PaidAt.Before(trade.OpenPositionAt):
+		message = "PaidAt must not be before the trade was opened"
+	case trade.ClosePositionAt != nil && data.PaidAt.After(*trade.ClosePositionAt):
+		message = "PaidAt must not be after the trade was closed"
+	case !data.Amount.Valid && (!data.Rate.Valid || !data.MarkPrice.Valid):
+		message = "Either Amount or Rate and MarkPrice are required"
+	case data.MarkPrice.Valid && data.MarkPrice.Decimal.Sign() <= 0:
+		message = "MarkPrice must be greater than 0"
+	}
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+
+	payment := models.FundingPayment{
+		PaymentId: uuid.New().String(),
+		TradId:    trade.TradId,
+		UserId:    userId,
+		Rate:      data.Rate,
+		MarkPrice: data.MarkPrice,
+		Amount:    data.Amount.Decimal,
+		PaidAt:    data.PaidAt,
+	}
+	if !data.Amount.Valid {
+		// Funding is charged on the size still open at the funding time
+		units := trade.Quantity
+		if trade.IsOpen() {
+			units = trade.Quantity.Sub(trade.ExitedQuantity)
+		}
+		units = units.Mul(trade.ContractMultiplier())
+		payment.Amount = trade.DirectionSign().Mul(data.Rate.Decimal).Mul(data.MarkPrice.Decimal).Mul(units).Round(models.MoneyScale)
+	}
+
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		// Funding entered on the trade before its first payment is kept as
+		// a payment of its own, the same as the entry of a trade getting its
+		// first execution
+		_, paid, err := fundingPaymentTotal(tx, trade.TradId)
+		if err != nil {
+			return err
+		}
+		if !paid && !trade.Funding.IsZero() {
+			err := tx.Create(&models.FundingPayment{
+				PaymentId: uuid.New().String(),
+				TradId:    trade.TradId,
+				UserId:    userId,
+				Amount:    trade.Funding,
+				PaidAt:    trade.OpenPositionAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&payment).Error; err != nil {
+			return err
+		}
+		return syncTradeFunding(tx, trade)
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while adding the funding payment"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"payment": serializeFundingPayment(payment),
+		"trade":   serializeTrade(*trade),
+	})
+}
+
+// DeleteFundingPayment soft deletes a funding payment and sums the trade's
+// funding costs up again from the remaining payments
+func DeleteFundingPayment(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+
+	payment := &models.FundingPayment{}
+	result := utils.DB.Where("payment_id = ? AND trad_id = ?", r.PathValue("paymentId"), trade.TradId).First(payment)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Funding payment not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the funding payment"})
+		return
+	}
+
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(payment).Error; err != nil {
+			return err
+		}
+		return syncTradeFunding(tx, trade)
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while deleting the funding payment"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serializeFundingPayment builds the JSON representation of a funding payment returned by the API
+func serializeFundingPayment(payment models.FundingPayment) map[string]interface{} {
+	return map[string]interface{}{
+		"id":        payment.PaymentId,
+		"tradeId":   payment.TradId,
+		"rate":      payment.Rate,
+		"markPrice": payment.MarkPrice,
+		"amount":    payment.Amount,
+		"paidAt":    payment.PaidAt,
+	}
+}
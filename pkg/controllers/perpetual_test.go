@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+// serveFunding runs the funding payment handler for the user and decodes
+// the JSON response
+func serveFunding(t *testing.T, handler http.HandlerFunc, method string, userId string, tradeId string, paymentId string, body string) (int, map[string]interface{}) {
+	t.Helper()
+	r := asUser(httptest.NewRequest(method, "/trade/"+tradeId+"/funding/"+paymentId, strings.NewReader(body)), userId)
+	r.SetPathValue("id", tradeId)
+	r.SetPathValue("paymentId", paymentId)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	var response map[string]interface{}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code, response
+}
+
+// fundingTotals sums the funding payments of each trade
+func fundingTotals(t *testing.T) map[string]string {
+	t.Helper()
+	var payments []models.FundingPayment
+	if err := utils.DB.Find(&payments).Error; err != nil {
+		t.Fatalf("listing funding payments: %v", err)
+	}
+	totals := map[string]decimal.Decimal{}
+	for _, payment := range payments {
+		totals[payment.TradId] = totals[payment.TradId].Add(payment.Amount)
+	}
+	formatted := map[string]string{}
+	for tradeId, total := range totals {
+		formatted[tradeId] = total.String()
+	}
+	return formatted
+}
+
+func TestAddFundingPayment(t *testing.T) {
+	useTestDB(t)
+	createTestTrade(t, "trade-1", "alice")
+
+	tests := []struct {
+		name   string
+		userId string
+		body   string
+		status int
+	}{
+		{"another user", "bob", `{"amount": 1, "paidAt": "2024-03-05T00:00:00Z"}`, http.StatusNotFound},
+		{"no time", "alice", `{"amount": 1}`, http.StatusBadRequest},
+		{"before the open", "alice", `{"amount": 1, "paidAt": "2024-03-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"rate without mark price", "alice", `{"rate": 0.001, "paidAt": "2024-03-05T00:00:00Z"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := serveFunding(t, AddFundingPayment, http.MethodPost, tt.userId, "trade-1", "", tt.body)
+			if code != tt.status {
+				t.Errorf("AddFundingPayment() status = %d, want %d: %v", code, tt.status, response)
+			}
+		})
+	}
+
+	// Funding entered by hand before the first payment is kept as a payment
+	if err := utils.DB.Model(&models.Trade{}).Where("trad_id = ?", "trade-1").Update("funding", 4).Error; err != nil {
+		t.Fatalf("entering funding: %v", err)
+	}
+	code, response := serveFunding(t, AddFundingPayment, http.MethodPost, "alice", "trade-1", "", `{"amount": 6, "paidAt": "2024-03-05T00:00:00Z"}`)
+	if code != http.StatusCreated || response["trade"].(map[string]interface{})["funding"] != "10" {
+		t.Fatalf("AddFundingPayment() = %d %v, want funding 10", code, response)
+	}
+	// Longs pay a positive rate on the open size at the mark price
+	code, response = serveFunding(t, AddFundingPayment, http.MethodPost, "alice", "trade-1", "", `{"rate": 0.001, "markPrice": 110, "paidAt": "2024-03-05T08:00:00Z"}`)
+	if code != http.StatusCreated || response["payment"].(map[string]interface{})["amount"] != "1.1" || response["trade"].(map[string]interface{})["funding"] != "11.1" {
+		t.Fatalf("AddFundingPayment() from the rate = %d %v, want 1.1 paid", code, response)
+	}
+	paymentId := response["payment"].(map[string]interface{})["id"].(string)
+
+	// A partial close takes its share of every payment along
+	code, response = closeTrade(t, "alice", "trade-1", `{"closePrice": 110, "quantity": 4, "closePositionAt": "2024-03-06T15:00:00Z"}`)
+	if code != http.StatusOK {
+		t.Fatalf("CloseTrade() status = %d: %v", code, response)
+	}
+	closed := response["closed"].(map[string]interface{})
+	remaining := response["remaining"].(map[string]interface{})
+	if closed["funding"] != "4.44" || remaining["funding"] != "6.66" {
+		t.Errorf("funding closed = %v and remaining = %v, want 4.44 and 6.66", closed["funding"], remaining["funding"])
+	}
+	if totals := fundingTotals(t); totals["trade-1"] != "6.66" || totals[closed["id"].(string)] != "4.44" {
+		t.Errorf("funding payments add up to %v, want 6.66 for trade-1 and 4.44 for the closed trade", totals)
+	}
+
+	// Deleting a payment sums the funding up again from the rest
+	if code, response := serveFunding(t, DeleteFundingPayment, http.MethodDelete, "alice", "trade-1", paymentId, ""); code != http.StatusNoContent {
+		t.Fatalf("DeleteFundingPayment() status = %d: %v", code, response)
+	}
+	trade, err := findUserTrade("trade-1", "alice")
+	if err != nil {
+		t.Fatalf("fetching the trade: %v", err)
+	}
+	if !trade.Funding.Equal(decimal.RequireFromString("6")) {
+		t.Errorf("Funding = %s after deleting the rate payment, want 6", trade.Funding)
+	}
+}
@@ -0,0 +1,346 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	maxProfilePictureSize = 5 << 20
+	// profilePictureURLLifetime outlives a page load so the picture can be
+	// cached by the browser
+	profilePictureURLLifetime = 60 * 60
+)
+
+// ProfileHandler dispatches /profile to the handler for the request method
+func ProfileHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		GetProfile(w, r)
+	case http.MethodPut, http.MethodPatch:
+		UpdateProfile(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ProfilePictureHandler dispatches /profile/picture to the handler for the
+// request method
+func ProfilePictureHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		AddProfilePicture(w, r)
+	case http.MethodDelete:
+		DeleteProfilePicture(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// findUser loads the user with the given Cognito username
+func findUser(userId string) (*models.User, error) {
+	user := &models.User{}
+	result := utils.DB.Where("user_id = ?", userId).First(user)
+	return user, result.Error
+}
+
+// profilePictureURL returns the URL the user's profile picture is served
+// from. Pictures are served from PROFILE_PICTURE_BASE_URL, typically a CDN in
+// front of the bucket, when it is set and through a presigned URL otherwise.
+// Users without an uploaded picture keep whatever ProfileUrl they had.
+func profilePictureURL(r *http.Request, user *models.User) (string, error) {
+	if user.ProfileKey == "" {
+		return user.ProfileUrl, nil
+	}
+	if baseURL := os.Getenv("PROFILE_PICTURE_BASE_URL"); baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/") + "/" + user.ProfileKey, nil
+	}
+	return utils.Storage.GenerateGetURL(r.Context(), utils.StorageBucket, user.ProfileKey, profilePictureURLLifetime)
+}
+
+// UpdateProfile changes the names of the user in Cognito and in the
+// database along with the timezone, which only the database keeps. Cognito
+// is updated first, so a rejected update leaves the profile untouched.
+func UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	type FormData struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+		FullName  string `json:"fullName"`
+		Timezone  string `json:"timezone"`
+	}
+
+	userId, _ := r.Context().Value("username").(string)
+	user, err := findUser(userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the profile"})
+		return
+	}
+
+	// PATCH starts from the stored values, PUT from an empty form
+	var data FormData
+	if r.Method == http.MethodPatch {
+		data = FormData{FirstName: user.FirstName, LastName: user.LastName, FullName: user.FullName, Timezone: user.Timezone}
+	}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+	data.FirstName = strings.TrimSpace(data.FirstName)
+	data.LastName = strings.TrimSpace(data.LastName)
+	data.FullName = strings.TrimSpace(data.FullName)
+	if data.FirstName == "" || data.LastName == "" || data.FullName == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "All fields (fullName, firstName, lastName) are required"})
+		return
+	}
+	data.Timezone = strings.TrimSpace(data.Timezone)
+	if data.Timezone == "" {
+		data.Timezone = "UTC"
+	}
+	if _, err := loadTimezone(data.Timezone); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Timezone must be an IANA timezone such as Europe/London"})
+		return
+	}
+
+	auth, err := utils.InitAWSConfig()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Something went wrong"})
+		return
+	}
+	err = auth.AdminUpdateUserAttributes(user.UserId, map[string]string{
+		"given_name":  data.FirstName,
+		"family_name": data.LastName,
+		"name":        data.FullName,
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while updating the profile"})
+		return
+	}
+
+	user.FirstName = data.FirstName
+	user.LastName = data.LastName
+	user.FullName = data.FullName
+	user.Timezone = data.Timezone
+	result := utils.DB.Save(user)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while updating the profile"})
+		return
+	}
+
+	GetProfile(w, r)
+}
+
+// AddProfilePicture hands out a presigned URL the client PUTs the new
+// profile picture to. The picture replaces the current one once confirmed
+// with ConfirmProfilePicture.
+func AddProfilePicture(w http.ResponseWriter, r *http.Request) {
+	type FormData struct {
+		ContentType string `json:"contentType"`
+	}
+
+	var data FormData
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+	extension, ok := attachmentContentTypes[data.ContentType]
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Content type must be one of image/png, image/jpeg, image/gif or image/webp"})
+		return
+	}
+
+	userId, _ := r.Context().Value("username").(string)
+	user, err := findUser(userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the profile"})
+		return
+	}
+
+	// Every upload gets a new key so cached copies of the previous picture
+	// are never served in its place
+	objectKey := fmt.Sprintf("users/%s/profile/%s%s", user.UserId, uuid.New().String(), extension)
+	uploadURL, err := utils.Storage.GeneratePutURL(r.Context(), utils.StorageBucket, objectKey, uploadURLLifetime)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while preparing the upload"})
+		return
+	}
+	// An earlier upload that was never confirmed is abandoned
+	if user.PendingProfileKey != "" {
+		utils.Storage.DeleteObject(r.Context(), utils.StorageBucket, user.PendingProfileKey)
+	}
+	user.PendingProfileKey = objectKey
+	result := utils.DB.Save(user)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while preparing the upload"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"uploadUrl":    uploadURL,
+		"contentType":  data.ContentType,
+		"urlExpiresIn": uploadURLLifetime,
+	})
+}
+
+// ConfirmProfilePicture checks the pending upload and makes it the profile
+// picture, deleting the previous one. Uploads that are too large or not of an
+// accepted image type are removed and rejected.
+func ConfirmProfilePicture(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	user, err := findUser(userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the profile"})
+		return
+	}
+	if user.PendingProfileKey == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "No profile picture upload is pending"})
+		return
+	}
+
+	info, err := utils.Storage.HeadObject(r.Context(), utils.StorageBucket, user.PendingProfileKey)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, utils.ErrObjectNotFound) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": "The file has not been uploaded yet"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while confirming the upload"})
+		return
+	}
+	if _, ok := attachmentContentTypes[info.ContentType]; !ok || info.Size > maxProfilePictureSize {
+		utils.Storage.DeleteObject(r.Context(), utils.StorageBucket, user.PendingProfileKey)
+		user.PendingProfileKey = ""
+		utils.DB.Save(user)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("Profile pictures must be PNG, JPEG, GIF or WebP images of at most %d MB", maxProfilePictureSize>>20)})
+		return
+	}
+
+	previousKey := user.ProfileKey
+	user.ProfileKey = user.PendingProfileKey
+	user.PendingProfileKey = ""
+	result := utils.DB.Save(user)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while confirming the upload"})
+		return
+	}
+	// The new picture is in place, losing the old object now only leaves
+	// an orphan behind
+	if previousKey != "" {
+		utils.Storage.DeleteObject(r.Context(), utils.StorageBucket, previousKey)
+	}
+
+	GetProfile(w, r)
+}
+
+// DeleteProfilePicture removes the user's profile picture
+func DeleteProfilePicture(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	user, err := findUser(userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "User not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the profile"})
+		return
+	}
+
+	if user.ProfileKey != "" {
+		if err := utils.Storage.DeleteObject(r.Context(), utils.StorageBucket, user.ProfileKey); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while deleting the profile picture"})
+			return
+		}
+	}
+	user.ProfileKey = ""
+	user.ProfileUrl = ""
+	result := utils.DB.Save(user)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while deleting the profile picture"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
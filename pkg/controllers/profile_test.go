@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+)
+
+// serveProfile runs the handler for the user and decodes the JSON response
+func serveProfile(t *testing.T, handler http.HandlerFunc, method string, userId string, body string) (int, map[string]interface{}) {
+	t.Helper()
+	r := asUser(httptest.NewRequest(method, "/profile/picture", strings.NewReader(body)), userId)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	var response map[string]interface{}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code, response
+}
+
+// uploadProfilePicture requests an upload URL for the user, stores the
+// picture under its key and returns the key
+func uploadProfilePicture(t *testing.T, store *utils.MemoryStore, userId string, info utils.ObjectInfo) string {
+	t.Helper()
+	code, response := serveProfile(t, AddProfilePicture, http.MethodPost, userId, `{"contentType": "image/png"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("AddProfilePicture() status = %d: %v", code, response)
+	}
+	key := strings.TrimPrefix(response["uploadUrl"].(string), "memory://"+testBucket+"/")
+	key, _, _ = strings.Cut(key, "?")
+	store.Put(testBucket, key, info)
+	return key
+}
+
+func TestProfilePicture(t *testing.T) {
+	useTestDB(t)
+	store := useTestStorage(t)
+	createTestUser(t, "alice")
+	png := utils.ObjectInfo{Size: 2048, ContentType: "image/png"}
+
+	if code, response := serveProfile(t, AddProfilePicture, http.MethodPost, "alice", `{"contentType": "image/svg+xml"}`); code != http.StatusBadRequest {
+		t.Errorf("AddProfilePicture() of an SVG status = %d, want %d: %v", code, http.StatusBadRequest, response)
+	}
+	if code, response := serveProfile(t, ConfirmProfilePicture, http.MethodPost, "alice", ""); code != http.StatusConflict {
+		t.Errorf("ConfirmProfilePicture() without an upload status = %d, want %d: %v", code, http.StatusConflict, response)
+	}
+
+	first := uploadProfilePicture(t, store, "alice", png)
+	if !strings.HasPrefix(first, "users/alice/profile/") {
+		t.Errorf("upload key = %q, want one under the prefix of alice", first)
+	}
+	code, response := serveProfile(t, ConfirmProfilePicture, http.MethodPost, "alice", "")
+	if code != http.StatusOK || response["profilePictureURL"] != "memory://"+testBucket+"/"+first+"?method=GET&expires=3600" {
+		t.Fatalf("ConfirmProfilePicture() = %d %v, want the picture served from %s", code, response, first)
+	}
+
+	// A new picture replaces the previous one in storage
+	second := uploadProfilePicture(t, store, "alice", png)
+	if code, response := serveProfile(t, ConfirmProfilePicture, http.MethodPost, "alice", ""); code != http.StatusOK {
+		t.Fatalf("ConfirmProfilePicture() status = %d: %v", code, response)
+	}
+	if keys := store.Keys(testBucket); len(keys) != 1 || keys[0] != second {
+		t.Errorf("stored files = %v, want only %s", keys, second)
+	}
+
+	// Oversized uploads are removed and the current picture kept
+	uploadProfilePicture(t, store, "alice", utils.ObjectInfo{Size: maxProfilePictureSize + 1, ContentType: "image/png"})
+	if code, response := serveProfile(t, ConfirmProfilePicture, http.MethodPost, "alice", ""); code != http.StatusBadRequest {
+		t.Errorf("ConfirmProfilePicture() of an oversized file status = %d, want %d: %v", code, http.StatusBadRequest, response)
+	}
+	if keys := store.Keys(testBucket); len(keys) != 1 || keys[0] != second {
+		t.Errorf("stored files = %v, want only %s", keys, second)
+	}
+
+	t.Setenv("PROFILE_PICTURE_BASE_URL", "https://cdn.example.com/")
+	if code, response := serveProfile(t, GetProfile, http.MethodGet, "alice", ""); code != http.StatusOK || response["profilePictureURL"] != "https://cdn.example.com/"+second {
+		t.Errorf("GetProfile() = %d %v, want the picture served from the CDN", code, response)
+	}
+
+	if code, response := serveProfile(t, DeleteProfilePicture, http.MethodDelete, "alice", ""); code != http.StatusNoContent {
+		t.Fatalf("DeleteProfilePicture() status = %d: %v", code, response)
+	}
+	if keys := store.Keys(testBucket); len(keys) != 0 {
+		t.Errorf("stored files = %v, want none", keys)
+	}
+	if code, response := serveProfile(t, GetProfile, http.MethodGet, "alice", ""); code != http.StatusOK || response["profilePictureURL"] != "" {
+		t.Errorf("GetProfile() = %d %v, want no picture", code, response)
+	}
+}
+
+func TestUpdateProfileRejectsInvalidTimezone(t *testing.T) {
+	useTestDB(t)
+	createTestUser(t, "alice")
+
+	for _, timezone := range []string{"Local", "GMT+25", "Europe/Atlantis"} {
+		code, response := serveProfile(t, UpdateProfile, http.MethodPatch, "alice", `{"firstName": "Alice", "lastName": "Smith", "fullName": "Alice Smith", "timezone": "`+timezone+`"}`)
+		if code != http.StatusBadRequest || response["error"] != "Timezone must be an IANA timezone such as Europe/London" {
+			t.Errorf("UpdateProfile() with timezone %q = %d %v, want %d", timezone, code, response, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// tradingDaysPerYear annualizes daily ratios
+const tradingDaysPerYear = 252
+
+// nullRatio wraps a ratio computed in floating point, which is null when it
+// is undefined
+func nullRatio(value float64) decimal.NullDecimal {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return decimal.NullDecimal{}
+	}
+	return decimal.NewNullDecimal(decimal.NewFromFloat(value).Round(models.PercentScale))
+}
+
+// meanAndStdDev returns the mean and the sample standard deviation of the
+// values. The deviation is NaN with less than two values.
+func meanAndStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return math.NaN(), math.NaN()
+	}
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	mean := sum / float64(len(values))
+	if len(values) < 2 {
+		return mean, math.NaN()
+	}
+	var squares float64
+	for _, value := range values {
+		squares += (value - mean) * (value - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)-1))
+}
+
+// accountCursor walks the balance series of an account day by day to tell
+// the balance invested in it at the start of each day
+type accountCursor struct {
+	series  []balancePoint
+	next    int
+	balance decimal.Decimal
+}
+
+// investedOn returns the balance of the account at the start of the day
+// plus the day's flows. Days must be passed in order.
+func (c *accountCursor) investedOn(day time.Time) decimal.Decimal {
+	for c.next < len(c.series) && c.series[c.next].Date.Before(day) {
+		c.balance = c.series[c.next].Balance
+		c.next++
+	}
+	if c.next < len(c.series) && c.series[c.next].Date.Equal(day) {
+		return c.balance.Add(c.series[c.next].Flows)
+	}
+	return c.balance
+}
+
+// GetRiskStats returns the risk-adjusted performance of the caller's closed
+// trades. The Sharpe, Sortino and Calmar ratios are based on daily returns,
+// the net P&L of the trades closed each UTC day over the balance invested
+// in their accounts at the start of the day, plus the capital parameter
+// backing trades without an account. Weekdays without closed trades count
+// as flat days and ratios are annualized over 252 trading days. They are
+// null when no balance backs the trades. riskFreeRate is the annual
+// risk-free rate in percent, RISK_FREE_RATE or 0 by default. The System
+// Quality Number, the standard deviation of R-multiples and the Kelly
+// fraction are based on the trades themselves. It accepts the same filters
+// as ListTrades.
+func GetRiskStats(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	query := r.URL.Query()
+
+	riskFreeParam := query.Get("riskFreeRate")
+	if riskFreeParam == "" {
+		riskFreeParam = os.Getenv("RISK_FREE_RATE")
+	}
+	riskFreeRate := decimal.Zero
+	if riskFreeParam != "" {
+		parsed, err := decimal.NewFromString(riskFreeParam)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "riskFreeRate must be a percentage"})
+			return
+		}
+		riskFreeRate = parsed
+	}
+	capital := decimal.Zero
+	if capitalParam := query.Get("capital"); capitalParam != "" {
+		parsed, err := decimal.NewFromString(capitalParam)
+		if err != nil || parsed.IsNegative() {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "capital must be a number of at least 0"})
+			return
+		}
+		capital = parsed
+	}
+
+	tx, message := filterUserTrades(userId, query)
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+	tx = tx.Where("trades.status = ? AND trades.close_position_at IS NOT NULL", models.TradeStatusClosed).
+		Session(&gorm.Session{})
+
+	var trades struct {
+		TradeCount  int64
+		WinCount    int64
+		AverageWin  decimal.NullDecimal
+		AverageLoss decimal.NullDecimal
+		RCount      int64
+		AverageR    decimal.NullDecimal
+		RStdDev     decimal.NullDecimal
+	}
+	result := tx.Select(`COUNT(*) AS trade_count,
+		COUNT(*) FILTER (WHERE trades.net_pnl > 0) AS win_count,
+		ROUND(AVG(trades.net_pnl) FILTER (WHERE trades.net_pnl > 0), 18) AS average_win,
+		ROUND(AVG(trades.net_pnl) FILTER (WHERE trades.net_pnl < 0), 18) AS average_loss,
+		COUNT(trades.r_multiple) AS r_count,
+		ROUND(AVG(trades.r_multiple), 8) AS average_r,
+		ROUND(STDDEV_SAMP(trades.r_multiple), 8) AS r_std_dev`).
+		Scan(&trades)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing risk statistics"})
+		return
+	}
+
+	var days []struct {
+		Day       time.Time
+		AccountId string
+		Pnl       decimal.Decimal
+	}
+	result = tx.Select("date_trunc('day', trades.close_position_at AT TIME ZONE 'UTC') AS day, COALESCE(trades.account_id, '') AS account_id, SUM(trades.net_pnl) AS pnl").
+		Group("day, trades.account_id").Order("day").Scan(&days)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing risk statistics"})
+		return
+	}
+
+	// Every account the trades were closed in backs the returns of each day,
+	// whether or not it traded that day
+	cursors := map[string]*accountCursor{}
+	pnlByDay := map[string]decimal.Decimal{}
+	for _, day := range days {
+		key := day.Day.Format(time.DateOnly)
+		pnlByDay[key] = pnlByDay[key].Add(day.Pnl)
+		if day.AccountId == "" || cursors[day.AccountId] != nil {
+			continue
+		}
+		// Trades of a deleted account have no balance backing them
+		cursors[day.AccountId] = &accountCursor{}
+		account, err := findUserAccount(day.AccountId, userId)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err == nil {
+			cursors[day.AccountId].balance = account.StartingBalance
+			cursors[day.AccountId].series, err = accountBalanceSeries(account)
+		}
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing account balances"})
+			return
+		}
+	}
+
+	var returns []float64
+	backed := len(days) > 0
+	if backed {
+		last := days[len(days)-1].Day
+		for day := days[0].Day; !day.After(last); day = day.AddDate(0, 0, 1) {
+			pnl, traded := pnlByDay[day.Format(time.DateOnly)]
+			if !traded && (day.Weekday() == time.Saturday || day.Weekday() == time.Sunday) {
+				continue
+			}
+			invested := capital
+			for _, cursor := range cursors {
+				invested = invested.Add(cursor.investedOn(day))
+			}
+			if !invested.IsPositive() {
+				backed, returns = false, nil
+				break
+			}
+			dailyReturn, _ := pnl.Div(invested).Float64()
+			returns = append(returns, dailyReturn)
+		}
+	}
+
+	var sharpe, sortino, calmar, annualizedReturn, volatility, maxDrawdownPct decimal.NullDecimal
+	if backed {
+		annualRiskFree, _ := riskFreeRate.Shift(-2).Float64()
+		dailyRiskFree := annualRiskFree / tradingDaysPerYear
+		excess := make([]float64, 0, len(returns))
+		var downside float64
+		growth, peak, maxDrawdown := 1.0, 1.0, 0.0
+		for _, dailyReturn := range returns {
+			excess = append(excess, dailyReturn-dailyRiskFree)
+			if dailyReturn < dailyRiskFree {
+				downside += (dailyReturn - dailyRiskFree) * (dailyReturn - dailyRiskFree)
+			}
+			growth *= 1 + dailyReturn
+			peak = math.Max(peak, growth)
+			maxDrawdown = math.Max(maxDrawdown, (peak-growth)/peak)
+		}
+		meanExcess, stdDev := meanAndStdDev(excess)
+		annualized := math.Pow(growth, float64(tradingDaysPerYear)/float64(len(returns))) - 1
+		downsideDeviation := math.Sqrt(downside / float64(len(returns)))
+
+		sharpe = nullRatio(meanExcess / stdDev * math.Sqrt(tradingDaysPerYear))
+		sortino = nullRatio(meanExcess / downsideDeviation * math.Sqrt(tradingDaysPerYear))
+		calmar = nullRatio(annualized / maxDrawdown)
+		annualizedReturn = nullRatio(annualized * 100)
+		volatility = nullRatio(stdDev * math.Sqrt(tradingDaysPerYear) * 100)
+		maxDrawdownPct = nullRatio(maxDrawdown * 100)
+	}
+
+	// The System Quality Number is the mean R-multiple over its deviation,
+	// scaled by the square root of the number of trades
+	var sqn decimal.NullDecimal
+	if trades.AverageR.Valid && trades.RStdDev.Valid && trades.RStdDev.Decimal.IsPositive() {
+		averageR, _ := trades.AverageR.Decimal.Float64()
+		stdDevR, _ := trades.RStdDev.Decimal.Float64()
+		sqn = nullRatio(math.Sqrt(float64(trades.RCount)) * averageR / stdDevR)
+	}
+	// The Kelly fraction is the win rate less the loss rate over the payoff
+	// ratio, the share of capital to risk per trade
+	var kelly decimal.NullDecimal
+	if trades.AverageWin.Valid && trades.AverageLoss.Valid {
+		winRate := float64(trades.WinCount) / float64(trades.TradeCount)
+		payoff, _ := trades.AverageWin.Decimal.Div(trades.AverageLoss.Decimal.Abs()).Float64()
+		kelly = nullRatio(winRate - (1-winRate)/payoff)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"riskFreeRate":         riskFreeRate,
+		"tradingDays":          len(returns),
+		"annualizedReturn":     annualizedReturn,
+		"annualizedVolatility": volatility,
+		"maxDrawdownPercent":   maxDrawdownPct,
+		"sharpeRatio":          sharpe,
+		"sortinoRatio":         sortino,
+		"calmarRatio":          calmar,
+		"tradeCount":           trades.TradeCount,
+		"rMultipleCount":       trades.RCount,
+		"averageR":             trades.AverageR,
+		"rStdDev":              trades.RStdDev,
+		"sqn":                  sqn,
+		"kellyFraction":        kelly,
+	})
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestMeanAndStdDev(t *testing.T) {
+	tests := []struct {
+		name          string
+		values        []float64
+		mean, stdDev  float64
+		noMean, noDev bool
+	}{
+		{"no values", nil, 0, 0, true, true},
+		{"one value", []float64{3}, 3, 0, false, true},
+		{"sample deviation", []float64{2, 4, 4, 4, 5, 5, 7, 9}, 5, math.Sqrt(32.0 / 7), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mean, stdDev := meanAndStdDev(tt.values)
+			if math.IsNaN(mean) != tt.noMean || (!tt.noMean && math.Abs(mean-tt.mean) > 1e-12) {
+				t.Errorf("mean = %v, want %v", mean, tt.mean)
+			}
+			if math.IsNaN(stdDev) != tt.noDev || (!tt.noDev && math.Abs(stdDev-tt.stdDev) > 1e-12) {
+				t.Errorf("stdDev = %v, want %v", stdDev, tt.stdDev)
+			}
+		})
+	}
+}
+
+func TestNullRatio(t *testing.T) {
+	for _, value := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if ratio := nullRatio(value); ratio.Valid {
+			t.Errorf("nullRatio(%v) = %v, want null", value, ratio)
+		}
+	}
+	if ratio := nullRatio(1.0 / 3); !ratio.Valid || !ratio.Decimal.Equal(decimal.RequireFromString("0.33333333")) {
+		t.Errorf("nullRatio(1/3) = %v, want 0.33333333", ratio)
+	}
+}
+
+func TestAccountCursor(t *testing.T) {
+	day := func(n int) time.Time {
+		return time.Date(2024, 3, n, 0, 0, 0, 0, time.UTC)
+	}
+	cursor := &accountCursor{series: []balancePoint{
+		{Date: day(4), Flows: decimal.NewFromInt(1000), Balance: decimal.NewFromInt(1000)},
+		{Date: day(6), Pnl: decimal.NewFromInt(50), Balance: decimal.NewFromInt(1050)},
+		{Date: day(8), Flows: decimal.NewFromInt(-200), Balance: decimal.NewFromInt(850)},
+	}}
+	tests := []struct {
+		day      int
+		invested string
+	}{
+		{3, "0"},
+		// The deposit of the day is invested from its start
+		{4, "1000"},
+		{5, "1000"},
+		{6, "1000"},
+		{7, "1050"},
+		// So is a withdrawal taken out of it
+		{8, "850"},
+		{11, "850"},
+	}
+	for _, tt := range tests {
+		if invested := cursor.investedOn(day(tt.day)); !invested.Equal(decimal.RequireFromString(tt.invested)) {
+			t.Errorf("investedOn(day %d) = %s, want %s", tt.day, invested, tt.invested)
+		}
+	}
+}
+
+func TestGetRiskStatsRejectsInvalidParameters(t *testing.T) {
+	useTestDB(t)
+	for _, query := range []string{"riskFreeRate=abc", "capital=-1", "capital=abc", "status=pending"} {
+		r := asUser(httptest.NewRequest(http.MethodGet, "/stats/risk?"+query, nil), "alice")
+		w := httptest.NewRecorder()
+		GetRiskStats(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GetRiskStats(%s) status = %d, want %d: %s", query, w.Code, http.StatusBadRequest, w.Body.String())
+		}
+	}
+}
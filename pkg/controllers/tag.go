@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TagHandler dispatches /tag to the handler for the request method
+func TagHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ListTags(w, r)
+	case http.MethodPost:
+		AddTag(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// TagDetailHandler dispatches /tag/{id} to the handler for the request method
+func TagDetailHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		GetTag(w, r)
+	case http.MethodPut, http.MethodPatch:
+		UpdateTag(w, r)
+	case http.MethodDelete:
+		DeleteTag(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// findUserTag loads the tag with the given TagId owned by the user. Tags
+// belonging to someone else are reported as not found.
+func findUserTag(tagId string, userId string) (*models.Tag, error) {
+	tag := &models.Tag{}
+	result := utils.DB.Where("tag_id = ? AND user_id = ?", tagId, userId).First(tag)
+	return tag, result.Error
+}
+
+// findUserTags loads the tags with the given TagIds, failing with
+// gorm.ErrRecordNotFound unless every one of them is owned by the user
+func findUserTags(tagIds []string, userId string) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	if len(tagIds) == 0 {
+		return tags, nil
+	}
+	result := utils.DB.Where("tag_id IN ? AND user_id = ?", tagIds, userId).Find(&tags)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	found := map[string]bool{}
+	for _, tag := range tags {
+		found[tag.TagId] = true
+	}
+	for _, tagId := range tagIds {
+		if !found[tagId] {
+			return nil, gorm.ErrRecordNotFound
+		}
+	}
+	return tags, nil
+}
+
+// tagNameTaken reports whether the user already has another tag of the same
+// kind with the given name
+func tagNameTaken(userId string, kind string, name string, exceptTagId string) (bool, error) {
+	var count int64
+	result := utils.DB.Model(&models.Tag{}).Where("user_id = ? AND kind = ? AND name = ? AND tag_id <> ?", userId, kind, name, exceptTagId).Count(&count)
+	return count > 0, result.Error
+}
+
+// ListTags returns the caller's tags, optionally only those of one kind
+func ListTags(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+
+	tx := utils.DB.Where("user_id = ?", userId)
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		tx = tx.Where("kind = ?", kind)
+	}
+	var tags []models.Tag
+	result := tx.Order("kind, name").Find(&tags)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while listing tags"})
+		return
+	}
+
+	serialized := make([]map[string]interface{}, 0, len(tags))
+	for _, tag := range tags {
+		serialized = append(serialized, serializeTag(tag))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"tags": serialized})
+}
+
+func AddTag(w http.ResponseWriter, r *http.Request) {
+	type FormData struct {
+		Kind        string `json:"kind"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	// Tags are plain tags unless stated otherwise
+	data := FormData{Kind: models.TagKindTag}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+
+	// Validate required fields
+	if data.Kind != models.TagKindTag && data.Kind != models.TagKindStrategy && data.Kind != models.TagKindMistake {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Kind must be tag, strategy or mistake"})
+		return
+	}
+	if data.Name == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Name is required"})
+		return
+	}
+
+	userId, _ := r.Context().Value("username").(string)
+	taken, err := tagNameTaken(userId, data.Kind, data.Name, "")
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while adding the tag"})
+		return
+	}
+	if taken {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Name already exists"})
+		return
+	}
+
+	tag := &models.Tag{
+		TagId:       uuid.New().String(),
+		UserId:      userId,
+		Kind:        data.Kind,
+		Name:        data.Name,
+		Description: data.Description,
+	}
+	result := utils.DB.Create(tag)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while adding the tag"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(serializeTag(*tag))
+}
+
+func GetTag(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	tag, err := findUserTag(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Tag not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the tag"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serializeTag(*tag))
+}
+
+// UpdateTag renames a tag or changes its description. The kind of a tag
+// cannot be changed.
+func UpdateTag(w http.ResponseWriter, r *http.Request) {
+	type FormData struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	userId, _ := r.Context().Value("username").(string)
+	tag, err := findUserTag(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Tag not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the tag"})
+		return
+	}
+
+	// PATCH starts from the stored values, PUT from an empty form
+	var data FormData
+	if r.Method == http.MethodPatch {
+		data = FormData{Name: tag.Name, Description: tag.Description}
+	}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
+	}
+	if data.Name == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Name is required"})
+		return
+	}
+
+	taken, err := tagNameTaken(userId, tag.Kind, data.Name, tag.TagId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while updating the tag"})
+		return
+	}
+	if taken {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Name already exists"})
+		return
+	}
+
+	tag.Name = data.Name
+	tag.Description = data.Description
+	result := utils.DB.Save(tag)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while updating the tag"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serializeTag(*tag))
+}
+
+// DeleteTag soft deletes the tag and detaches it from every trade
+func DeleteTag(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	tag, err := findUserTag(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Tag not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the tag"})
+		return
+	}
+
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM trade_tags WHERE tag_id = ?", tag.TagId).Error; err != nil {
+			return err
+		}
+		return tx.Delete(tag).Error
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while deleting the tag"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serializeTag builds the JSON representation of a tag returned by the API
+func serializeTag(tag models.Tag) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          tag.TagId,
+		"kind":        tag.Kind,
+		"name":        tag.Name,
+		"description": tag.Description,
+	}
+}
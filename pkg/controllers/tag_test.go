@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+// createTestTag stores a tag of the user, creating the user first when needed
+func createTestTag(t *testing.T, tagId string, userId string, kind string, name string) {
+	t.Helper()
+	createTestUser(t, userId)
+	tag := &models.Tag{TagId: tagId, UserId: userId, Kind: kind, Name: name}
+	if err := utils.DB.Create(tag).Error; err != nil {
+		t.Fatalf("creating tag %s: %v", tagId, err)
+	}
+}
+
+func TestAddTag(t *testing.T) {
+	useTestDB(t)
+	createTestTag(t, "tag-1", "alice", models.TagKindTag, "breakout")
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"plain tag", `{"name": "news"}`, http.StatusCreated},
+		{"strategy named like a tag", `{"kind": "strategy", "name": "breakout"}`, http.StatusCreated},
+		{"taken name", `{"name": "breakout"}`, http.StatusConflict},
+		{"mistake", `{"kind": "mistake", "name": "moved the stop"}`, http.StatusCreated},
+		{"unknown kind", `{"kind": "label", "name": "gap"}`, http.StatusBadRequest},
+		{"missing name", `{"kind": "tag"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := asUser(httptest.NewRequest(http.MethodPost, "/tag", strings.NewReader(tt.body)), "alice")
+			w := httptest.NewRecorder()
+			TagHandler(w, r)
+			if w.Code != tt.status {
+				t.Errorf("AddTag() status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTradeTags(t *testing.T) {
+	useTestDB(t)
+	createTestTrade(t, "trade-1", "alice")
+	createTestTrade(t, "trade-2", "alice")
+	createTestTag(t, "tag-1", "alice", models.TagKindTag, "breakout")
+	createTestTag(t, "tag-2", "alice", models.TagKindStrategy, "trend")
+	createTestTag(t, "tag-3", "bob", models.TagKindTag, "news")
+
+	if code, response := serveTrade(t, http.MethodPatch, "alice", "trade-1", `{"tagIds": ["tag-1", "tag-3"]}`); code != http.StatusBadRequest {
+		t.Errorf("PATCH with another user's tag status = %d, want %d: %v", code, http.StatusBadRequest, response)
+	}
+	code, response := serveTrade(t, http.MethodPatch, "alice", "trade-1", `{"tagIds": ["tag-1", "tag-2"]}`)
+	if code != http.StatusOK {
+		t.Fatalf("PATCH status = %d: %v", code, response)
+	}
+	if tags := response["tags"].([]interface{}); len(tags) != 2 {
+		t.Errorf("tags = %v, want tag-1 and tag-2", tags)
+	}
+	// A PATCH without tagIds keeps the tags
+	if code, response := serveTrade(t, http.MethodPatch, "alice", "trade-1", `{"margin": 1500}`); code != http.StatusOK || len(response["tags"].([]interface{})) != 2 {
+		t.Errorf("PATCH without tagIds = %d %v, want the tags kept", code, response["tags"])
+	}
+	if code, response := serveTrade(t, http.MethodPatch, "alice", "trade-2", `{"tagIds": ["tag-2"]}`); code != http.StatusOK {
+		t.Fatalf("PATCH status = %d: %v", code, response)
+	}
+
+	for tag, want := range map[string][]string{"tag-1": {"trade-1"}, "tag-2": {"trade-2", "trade-1"}, "tag-1,tag-2": {"trade-2", "trade-1"}} {
+		if _, ids, _ := listTrades(t, "alice", url.Values{"tag": {tag}}); !reflect.DeepEqual(ids, want) {
+			t.Errorf("trades tagged %s = %v, want %v", tag, ids, want)
+		}
+	}
+
+	// Deleting a tag detaches it from every trade
+	r := asUser(httptest.NewRequest(http.MethodDelete, "/tag/tag-2", nil), "alice")
+	r.SetPathValue("id", "tag-2")
+	w := httptest.NewRecorder()
+	TagDetailHandler(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("DeleteTag() status = %d: %s", w.Code, w.Body.String())
+	}
+	if _, ids, _ := listTrades(t, "alice", url.Values{"tag": {"tag-2"}}); len(ids) != 0 {
+		t.Errorf("trades tagged tag-2 after deleting it = %v, want none", ids)
+	}
+}
+
+func TestGetTagStats(t *testing.T) {
+	useTestDB(t)
+	createTestTag(t, "tag-1", "alice", models.TagKindTag, "breakout")
+	createTestTag(t, "tag-2", "alice", models.TagKindStrategy, "trend")
+	netPnls := map[string]int64{"trade-1": 100, "trade-2": -40, "trade-3": 30}
+	tagIds := map[string][]string{"trade-1": {"tag-1", "tag-2"}, "trade-2": {"tag-1"}, "trade-3": {"tag-2"}}
+	for tradeId, netPnl := range netPnls {
+		createTestTrade(t, tradeId, "alice")
+		updates := map[string]interface{}{"status": models.TradeStatusClosed, "realized_pnl": decimal.NewFromInt(netPnl), "net_pnl": decimal.NewFromInt(netPnl)}
+		if err := utils.DB.Model(&models.Trade{}).Where("trad_id = ?", tradeId).Updates(updates).Error; err != nil {
+			t.Fatalf("closing %s: %v", tradeId, err)
+		}
+		for _, tagId := range tagIds[tradeId] {
+			if err := utils.DB.Exec("INSERT INTO trade_tags (trad_id, tag_id) VALUES (?, ?)", tradeId, tagId).Error; err != nil {
+				t.Fatalf("tagging %s: %v", tradeId, err)
+			}
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"trend 2 100 130", "breakout 2 50 60"}},
+		{"kind=strategy", []string{"trend 2 100 130"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := asUser(httptest.NewRequest(http.MethodGet, "/stats/tags?"+tt.query, nil), "alice")
+			w := httptest.NewRecorder()
+			GetTagStats(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GetTagStats() status = %d: %s", w.Code, w.Body.String())
+			}
+			var response struct {
+				Tags []struct {
+					Name       string
+					TradeCount int64
+					WinRate    decimal.Decimal
+					NetPnl     decimal.Decimal
+				}
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+			}
+			got := []string{}
+			for _, tag := range response.Tags {
+				got = append(got, strings.Join([]string{tag.Name, decimal.NewFromInt(tag.TradeCount).String(), tag.WinRate.String(), tag.NetPnl.String()}, " "))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetTagStats() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
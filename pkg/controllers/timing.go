@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// marketSessions are the trading sessions trades are broken down by. Their
+// hours are in the local time of their market so they follow its daylight
+// saving time, and sessions overlap.
+var marketSessions = []struct {
+	key      string
+	timezone string
+	opens    string
+	closes   string
+}{
+	{"asia", "Asia/Tokyo", "09:00", "18:00"},
+	{"london", "Europe/London", "08:00", "17:00"},
+	{"newYork", "America/New_York", "08:00", "17:00"},
+}
+
+// holdingTimeBuckets are the holding time ranges trades are broken down by,
+// each running up to its upTo. The last bucket has no upper bound.
+var holdingTimeBuckets = []struct {
+	key  string
+	upTo time.Duration
+}{
+	{"under15m", 15 * time.Minute},
+	{"15mTo1h", time.Hour},
+	{"1hTo4h", 4 * time.Hour},
+	{"4hTo1d", 24 * time.Hour},
+	{"1dTo1w", 7 * 24 * time.Hour},
+	{"over1w", 0},
+}
+
+// timeSlotSizes are the accepted slotMinutes of the time of day breakdown,
+// all dividing an hour
+var timeSlotSizes = []int{5, 10, 15, 20, 30, 60}
+
+// timeBucketAggregates selects the performance of the closed trades of a
+// time bucket into a timeBucketRow
+const timeBucketAggregates = `COUNT(*) AS trade_count,
+	COUNT(*) FILTER (WHERE trades.net_pnl > 0) AS win_count,
+	COALESCE(SUM(trades.net_pnl), 0) AS net_pnl,
+	ROUND(AVG(trades.r_multiple), 8) AS average_r`
+
+// timeBucketRow is the performance of the closed trades of a time bucket
+type timeBucketRow struct {
+	Bucket     int
+	TradeCount int64
+	WinCount   int64
+	NetPnl     decimal.Decimal
+	AverageR   decimal.NullDecimal
+}
+
+// loadTimezone loads an IANA timezone. Unlike time.LoadLocation it rejects
+// the server's Local zone, which the database does not know.
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return time.LoadLocation(name)
+}
+
+// userLocation returns the timezone time based analytics of the user are
+// evaluated in, the timezone query parameter or else the one of the
+// profile. Users without a profile yet are in UTC. It returns an error
+// message when the timezone parameter is invalid.
+func userLocation(userId string, query url.Values) (*time.Location, string, error) {
+	if name := query.Get("timezone"); name != "" {
+		location, err := loadTimezone(name)
+		if err != nil {
+			return nil, "timezone must be an IANA timezone such as Europe/London", nil
+		}
+		return location, "", nil
+	}
+	user, err := findUser(userId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.UTC, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	location, err := loadTimezone(user.Timezone)
+	if err != nil {
+		return time.UTC, "", nil
+	}
+	return location, "", nil
+}
+
+// serializeTimeBucket builds the JSON representation of the performance of
+// a time bucket. Ratios are null for buckets without trades.
+func serializeTimeBucket(row timeBucketRow) map[string]interface{} {
+	var winRate, averagePnl decimal.NullDecimal
+	if row.TradeCount > 0 {
+		tradeCount := decimal.NewFromInt(row.TradeCount)
+		winRate = decimal.NewNullDecimal(decimal.NewFromInt(row.WinCount).Div(tradeCount).Shift(2).Round(models.PercentScale))
+		averagePnl = decimal.NewNullDecimal(row.NetPnl.Div(tradeCount).Round(models.MoneyScale))
+	}
+	return map[string]interface{}{
+		"tradeCount": row.TradeCount,
+		"winRate":    winRate,
+		"netPnl":     row.NetPnl,
+		"averagePnl": averagePnl,
+		"averageR":   row.AverageR,
+	}
+}
+
+// GetTimeStats breaks the performance of the caller's closed trades down by
+// when they were opened, per weekday, time of day and market session, and by
+// how long they were held. Weekdays and times of day are evaluated in the
+// timezone of the profile, or the timezone parameter when given. The time
+// of day is split into slots of slotMinutes, 60 by default. A trade opened
+// while sessions overlap counts towards each of them. It accepts the same
+// filters as ListTrades.
+func GetTimeStats(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	query := r.URL.Query()
+
+	slotMinutes := 60
+	if slotParam := query.Get("slotMinutes"); slotParam != "" {
+		parsed, err := strconv.Atoi(slotParam)
+		valid := err == nil
+		if valid {
+			valid = false
+			for _, size := range timeSlotSizes {
+				valid = valid || size == parsed
+			}
+		}
+		if !valid {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "slotMinutes must be 5, 10, 15, 20, 30 or 60"})
+			return
+		}
+		slotMinutes = parsed
+	}
+	location, message, err := userLocation(userId, query)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the profile"})
+		return
+	}
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+
+	tx, message := filterUserTrades(userId, query)
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+	tx = tx.Where("trades.status = ? AND trades.close_position_at IS NOT NULL", models.TradeStatusClosed).
+		Session(&gorm.Session{})
+	timezone := location.String()
+
+	// Weekdays are ISO numbered, Monday being 1 and Sunday 7
+	var weekdayRows []timeBucketRow
+	result := tx.Select("extract(isodow FROM trades.open_position_at AT TIME ZONE ?)::int AS bucket, "+timeBucketAggregates, timezone).
+		Group("bucket").Scan(&weekdayRows)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing time statistics"})
+		return
+	}
+	weekdays := make([]map[string]interface{}, 0, 7)
+	for day := 1; day <= 7; day++ {
+		row := timeBucketRow{Bucket: day}
+		for _, found := range weekdayRows {
+			if found.Bucket == day {
+				row = found
+			}
+		}
+		serialized := serializeTimeBucket(row)
+		serialized["weekday"] = time.Weekday(day % 7).String()
+		weekdays = append(weekdays, serialized)
+	}
+
+	var slotRows []timeBucketRow
+	result = tx.Select(`(extract(hour FROM trades.open_position_at AT TIME ZONE ?)::int * 60
+		+ extract(minute FROM trades.open_position_at AT TIME ZONE ?)::int) / ? AS bucket, `+timeBucketAggregates,
+		timezone, timezone, slotMinutes).
+		Group("bucket").Scan(&slotRows)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing time statistics"})
+		return
+	}
+	timesOfDay := make([]map[string]interface{}, 0, 24*60/slotMinutes)
+	for slot := 0; slot < 24*60/slotMinutes; slot++ {
+		row := timeBucketRow{Bucket: slot}
+		for _, found := range slotRows {
+			if found.Bucket == slot {
+				row = found
+			}
+		}
+		serialized := serializeTimeBucket(row)
+		serialized["startsAt"] = fmt.Sprintf("%02d:%02d", slot*slotMinutes/60, slot*slotMinutes%60)
+		timesOfDay = append(timesOfDay, serialized)
+	}
+
+	sessions := make([]map[string]interface{}, 0, len(marketSessions))
+	for _, session := range marketSessions {
+		var row timeBucketRow
+		result = tx.Where("(trades.open_position_at AT TIME ZONE ?)::time >= ?::time AND (trades.open_position_at AT TIME ZONE ?)::time < ?::time",
+			session.timezone, session.opens, session.timezone, session.closes).
+			Select(timeBucketAggregates).Scan(&row)
+		if result.Error != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing time statistics"})
+			return
+		}
+		serialized := serializeTimeBucket(row)
+		serialized["session"] = session.key
+		serialized["timezone"] = session.timezone
+		serialized["opens"] = session.opens
+		serialized["closes"] = session.closes
+		sessions = append(sessions, serialized)
+	}
+
+	// Bucket the holding time in seconds, the last bucket taking the rest
+	var holdingCase strings.Builder
+	holdingCase.WriteString("CASE")
+	for i, bucket := range holdingTimeBuckets[:len(holdingTimeBuckets)-1] {
+		fmt.Fprintf(&holdingCase, " WHEN extract(epoch FROM trades.close_position_at - trades.open_position_at) < %d THEN %d", int64(bucket.upTo.Seconds()), i)
+	}
+	fmt.Fprintf(&holdingCase, " ELSE %d END AS bucket, ", len(holdingTimeBuckets)-1)
+	var holdingRows []timeBucketRow
+	result = tx.Select(holdingCase.String() + timeBucketAggregates).Group("bucket").Scan(&holdingRows)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing time statistics"})
+		return
+	}
+	holdingTimes := make([]map[string]interface{}, 0, len(holdingTimeBuckets))
+	for i, bucket := range holdingTimeBuckets {
+		row := timeBucketRow{Bucket: i}
+		for _, found := range holdingRows {
+			if found.Bucket == i {
+				row = found
+			}
+		}
+		serialized := serializeTimeBucket(row)
+		serialized["bucket"] = bucket.key
+		holdingTimes = append(holdingTimes, serialized)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"timezone":     timezone,
+		"slotMinutes":  slotMinutes,
+		"weekdays":     weekdays,
+		"timesOfDay":   timesOfDay,
+		"sessions":     sessions,
+		"holdingTimes": holdingTimes,
+	})
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+func TestLoadTimezone(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"Europe/London", false},
+		{"UTC", false},
+		{"", true},
+		{"Local", true},
+		{"Mars/Olympus_Mons", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location, err := loadTimezone(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadTimezone(%q) error = %v, want error %v", tt.name, err, tt.wantErr)
+			}
+			if err == nil && location.String() != tt.name {
+				t.Errorf("loadTimezone(%q) = %s", tt.name, location)
+			}
+		})
+	}
+}
+
+func TestUserLocation(t *testing.T) {
+	useTestDB(t)
+	createTestUser(t, "alice")
+	if err := utils.DB.Model(&models.User{}).Where("user_id = ?", "alice").Update("timezone", "Asia/Tokyo").Error; err != nil {
+		t.Fatalf("setting the timezone: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		userId   string
+		timezone string
+		want     string
+		message  string
+	}{
+		{"timezone of the profile", "alice", "", "Asia/Tokyo", ""},
+		{"timezone parameter", "alice", "America/New_York", "America/New_York", ""},
+		{"invalid timezone parameter", "alice", "Local", "", "timezone must be an IANA timezone such as Europe/London"},
+		{"no profile yet", "bob", "", "UTC", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{}
+			if tt.timezone != "" {
+				query.Set("timezone", tt.timezone)
+			}
+			location, message, err := userLocation(tt.userId, query)
+			if err != nil {
+				t.Fatalf("userLocation() error = %v", err)
+			}
+			if message != tt.message {
+				t.Errorf("userLocation() message = %q, want %q", message, tt.message)
+			}
+			if tt.want != "" && (location == nil || location.String() != tt.want) {
+				t.Errorf("userLocation() = %v, want %s", location, tt.want)
+			}
+		})
+	}
+}
+
+func TestSerializeTimeBucket(t *testing.T) {
+	empty := serializeTimeBucket(timeBucketRow{Bucket: 1})
+	if empty["winRate"].(decimal.NullDecimal).Valid || empty["averagePnl"].(decimal.NullDecimal).Valid {
+		t.Errorf("serializeTimeBucket() of an empty bucket = %v, want null ratios", empty)
+	}
+
+	bucket := serializeTimeBucket(timeBucketRow{Bucket: 1, TradeCount: 3, WinCount: 2, NetPnl: decimal.NewFromInt(100)})
+	winRate := bucket["winRate"].(decimal.NullDecimal)
+	averagePnl := bucket["averagePnl"].(decimal.NullDecimal)
+	if !winRate.Valid || !winRate.Decimal.Equal(decimal.RequireFromString("66.66666667")) {
+		t.Errorf("winRate = %v, want 66.66666667", winRate)
+	}
+	if !averagePnl.Valid || !averagePnl.Decimal.Equal(decimal.NewFromInt(100).Div(decimal.NewFromInt(3)).Round(models.MoneyScale)) {
+		t.Errorf("averagePnl = %v, want a third of 100", averagePnl)
+	}
+}
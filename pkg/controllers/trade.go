@@ -1,28 +1,441 @@
 package controllers
 
 import (
+	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/abdullahelwalid/tradelog-go/pkg/models"
 	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
-func AddTrade(w http.ResponseWriter, r *http.Request) {
-	// Define the struct to map the form data
-	type FormData struct {
-		Asset          string    `json:"asset"`
-		OpenPositionAt time.Time `json:"openPositionAt"`
-		ClosePositionAt time.Time `json:"closePositionAt"`
-		Margin         float32   `json:"margin"`
-		OpenPrice      float32   `json:"openPrice"`
-		ClosePrice     float32   `json:"closePrice"`
+const (
+	defaultTradePageSize = 50
+	maxTradePageSize     = 200
+)
+
+// TradeHandler dispatches /trade to the handler for the request method
+func TradeHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ListTrades(w, r)
+	case http.MethodPost:
+		AddTrade(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// tradeForm maps the trade payload accepted by AddTrade and UpdateTrade
+type tradeForm struct {
+	AccountId       string              `json:"accountId"`
+	TagIds          []string            `json:"tagIds"`
+	Asset           string              `json:"asset"`
+	Direction       string              `json:"direction"`
+	Quantity        decimal.Decimal     `json:"quantity"`
+	OpenPositionAt  time.Time           `json:"openPositionAt"`
+	ClosePositionAt time.Time           `json:"closePositionAt"`
+	Margin          decimal.Decimal     `json:"margin"`
+	OpenPrice       decimal.Decimal     `json:"openPrice"`
+	ClosePrice      decimal.Decimal     `json:"closePrice"`
+	Commission      decimal.Decimal     `json:"commission"`
+	Fees            decimal.Decimal     `json:"fees"`
+	Swap            decimal.Decimal     `json:"swap"`
+	Funding         decimal.Decimal     `json:"funding"`
+	StopLoss        decimal.NullDecimal `json:"stopLoss"`
+	TakeProfit      decimal.NullDecimal `json:"takeProfit"`
+	PlannedRisk     decimal.NullDecimal `json:"plannedRisk"`
+	// Option contract, left empty for anything but options
+	OptionType       string              `json:"optionType"`
+	Underlying       string              `json:"underlying"`
+	Strike           decimal.NullDecimal `json:"strike"`
+	Expiry           string              `json:"expiry"`
+	Multiplier       decimal.Decimal     `json:"multiplier"`
+	OptionStrategyId string              `json:"optionStrategyId"`
+	// ContractMonth is the delivery month of a futures trade logged against
+	// its root symbol, formatted as 2006-01
+	ContractMonth string `json:"contractMonth"`
+	// rootSymbol and contractMultiplier are set by resolve for futures
+	rootSymbol         string
+	contractMultiplier decimal.Decimal
+	// Leveraged margin positions, left empty for unleveraged trades
+	Leverage              decimal.NullDecimal `json:"leverage"`
+	MarginMode            string              `json:"marginMode"`
+	MaintenanceMarginRate decimal.NullDecimal `json:"maintenanceMarginRate"`
+	// Pip quoted trades such as forex. Quantity is a number of lots when
+	// LotSize is set. ConversionRate is looked up in the FX rate table when
+	// it is not given.
+	LotSize        string              `json:"lotSize"`
+	ConversionRate decimal.NullDecimal `json:"conversionRate"`
+	// pipSize and quoteCurrency are set by resolve from the catalog
+	pipSize       decimal.NullDecimal
+	quoteCurrency string
+	// Psychology ratings, each from models.RatingMin to models.RatingMax
+	Confidence    *int `json:"confidence"`
+	EmotionBefore *int `json:"emotionBefore"`
+	EmotionAfter  *int `json:"emotionAfter"`
+	Discipline    *int `json:"discipline"`
+}
+
+// validate returns the error message for the first invalid field, or an
+// empty string when the form is valid. The close fields are optional so open
+// positions can be logged at entry, but they must be provided together.
+func (data tradeForm) validate() string {
+	// Options get their asset from the contract when it is left out
+	if data.Asset == "" && data.OptionType == "" {
+		return "Asset is required"
+	}
+	if data.OptionType != "" {
+		if data.OptionType != models.OptionTypeCall && data.OptionType != models.OptionTypePut {
+			return "OptionType must be call or put"
+		}
+		if data.Underlying == "" {
+			return "Underlying is required for options"
+		}
+		if !data.Strike.Valid || data.Strike.Decimal.Sign() <= 0 {
+			return "Strike must be greater than 0"
+		}
+		if _, err := time.Parse(time.DateOnly, data.Expiry); err != nil {
+			return "Expiry must be a date formatted as 2006-01-02"
+		}
+	}
+	if data.Multiplier.Sign() < 0 {
+		return "Multiplier must not be negative"
+	}
+	if data.ContractMonth != "" {
+		if _, err := time.Parse("2006-01", data.ContractMonth); err != nil {
+			return "ContractMonth must be formatted as 2006-01"
+		}
+	}
+	if data.Leverage.Valid && data.Leverage.Decimal.LessThan(decimal.NewFromInt(1)) {
+		return "Leverage must be at least 1"
+	}
+	if data.MarginMode != "" {
+		if data.MarginMode != models.MarginModeIsolated && data.MarginMode != models.MarginModeCross {
+			return "MarginMode must be isolated or cross"
+		}
+		if !data.Leverage.Valid {
+			return "MarginMode requires Leverage"
+		}
+	}
+	if data.MaintenanceMarginRate.Valid {
+		rate := data.MaintenanceMarginRate.Decimal
+		if rate.Sign() < 0 || rate.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+			return "MaintenanceMarginRate must be at least 0 and less than 1"
+		}
+	}
+	if _, ok := models.LotSizeFractions[data.LotSize]; data.LotSize != "" && !ok {
+		return "LotSize must be standard, mini or micro"
+	}
+	if data.ConversionRate.Valid && data.ConversionRate.Decimal.Sign() <= 0 {
+		return "ConversionRate must be greater than 0"
+	}
+	ratings := []struct {
+		name   string
+		rating *int
+	}{
+		{"Confidence", data.Confidence},
+		{"EmotionBefore", data.EmotionBefore},
+		{"EmotionAfter", data.EmotionAfter},
+		{"Discipline", data.Discipline},
+	}
+	for _, r := range ratings {
+		if r.rating != nil && (*r.rating < models.RatingMin || *r.rating > models.RatingMax) {
+			return fmt.Sprintf("%s must be between %d and %d", r.name, models.RatingMin, models.RatingMax)
+		}
+	}
+	if data.Direction != models.TradeDirectionLong && data.Direction != models.TradeDirectionShort {
+		return "Direction must be long or short"
+	}
+	if data.Quantity.Sign() <= 0 {
+		return "Quantity must be greater than 0"
+	}
+	if data.OpenPositionAt.IsZero() {
+		return "OpenPositionAt is required"
+	}
+
+	// Additional validation checks for Margin, OpenPrice, and ClosePrice.
+	// Long options default their margin to the premium paid and leveraged
+	// trades to the position value over the leverage.
+	if data.Margin.Sign() < 0 {
+		return "Margin must not be negative"
+	}
+	if data.Margin.IsZero() && !data.Leverage.Valid && (data.OptionType == "" || data.Direction != models.TradeDirectionLong) {
+		return "Margin must be greater than 0"
+	}
+	if data.OpenPrice.Sign() <= 0 {
+		return "OpenPrice must be greater than 0"
+	}
+	if data.ClosePrice.Sign() < 0 {
+		return "ClosePrice must not be negative"
+	}
+	// Options can be closed for nothing, so only their ClosePrice may be left
+	// at 0 once ClosePositionAt is set
+	if data.ClosePositionAt.IsZero() && !data.ClosePrice.IsZero() ||
+		!data.ClosePositionAt.IsZero() && data.ClosePrice.IsZero() && data.OptionType == "" {
+		return "ClosePositionAt and ClosePrice must be provided together"
+	}
+	if !data.ClosePositionAt.IsZero() && data.ClosePositionAt.Before(data.OpenPositionAt) {
+		return "ClosePositionAt must not be before OpenPositionAt"
+	}
+
+	// Swap and funding can be received, commission and fees are always paid
+	if data.Commission.Sign() < 0 {
+		return "Commission must not be negative"
+	}
+	if data.Fees.Sign() < 0 {
+		return "Fees must not be negative"
 	}
 
+	// The stop must be on the losing side of the entry and the target on
+	// the winning side
+	sign := 1
+	if data.Direction == models.TradeDirectionShort {
+		sign = -1
+	}
+	if data.StopLoss.Valid && data.StopLoss.Decimal.Sub(data.OpenPrice).Sign()*sign >= 0 {
+		return "StopLoss must be on the losing side of OpenPrice"
+	}
+	if data.TakeProfit.Valid && data.TakeProfit.Decimal.Sub(data.OpenPrice).Sign()*sign <= 0 {
+		return "TakeProfit must be on the winning side of OpenPrice"
+	}
+	if data.PlannedRisk.Valid && data.PlannedRisk.Decimal.Sign() <= 0 {
+		return "PlannedRisk must be greater than 0"
+	}
+	return ""
+}
+
+// apply copies the form fields onto the trade model. A trade without close
+// fields is stored as an open position.
+func (data tradeForm) apply(trade *models.Trade) {
+	trade.AccountId = data.AccountId
+	trade.OptionStrategyId = data.OptionStrategyId
+	trade.Asset = data.Asset
+	trade.OptionType = data.OptionType
+	trade.RootSymbol = data.rootSymbol
+	trade.ContractMonth = data.ContractMonth
+	trade.Multiplier = data.Multiplier
+	if data.OptionType == "" {
+		trade.Underlying = ""
+		trade.Strike = decimal.NullDecimal{}
+		trade.Expiry = nil
+		if trade.Multiplier.IsZero() {
+			trade.Multiplier = decimal.NewFromInt(1)
+		}
+	} else {
+		expiry, _ := time.Parse(time.DateOnly, data.Expiry)
+		trade.Underlying = data.Underlying
+		trade.Strike = data.Strike
+		trade.Expiry = &expiry
+		if trade.Multiplier.IsZero() {
+			trade.Multiplier = decimal.NewFromInt(models.DefaultOptionMultiplier)
+		}
+		if trade.Asset == "" {
+			trade.Asset = optionSymbol(trade)
+		}
+	}
+	trade.Direction = data.Direction
+	trade.Quantity = data.Quantity
+	trade.OpenPositionAt = data.OpenPositionAt
+	trade.Margin = data.Margin
+	trade.OpenPrice = data.OpenPrice
+	trade.ClosePrice = data.ClosePrice
+	trade.Commission = data.Commission
+	trade.Fees = data.Fees
+	trade.Swap = data.Swap
+	trade.Funding = data.Funding
+	trade.StopLoss = data.StopLoss
+	trade.TakeProfit = data.TakeProfit
+	trade.PlannedRisk = data.PlannedRisk
+	trade.Confidence = data.Confidence
+	trade.EmotionBefore = data.EmotionBefore
+	trade.EmotionAfter = data.EmotionAfter
+	trade.Discipline = data.Discipline
+	trade.LotSize = data.LotSize
+	trade.PipSize = data.pipSize
+	trade.ConversionRate = decimal.NewFromInt(1)
+	if data.ConversionRate.Valid {
+		trade.ConversionRate = data.ConversionRate.Decimal
+	}
+	trade.Leverage = data.Leverage
+	trade.MarginMode = ""
+	trade.MaintenanceMarginRate = decimal.NullDecimal{}
+	if data.Leverage.Valid {
+		trade.MarginMode = data.MarginMode
+		if trade.MarginMode == "" {
+			trade.MarginMode = models.MarginModeIsolated
+		}
+		trade.MaintenanceMarginRate = data.MaintenanceMarginRate
+	}
+	if trade.Margin.IsZero() {
+		trade.Margin = data.OpenPrice.Mul(data.Quantity).Mul(trade.Multiplier)
+		if data.Leverage.Valid {
+			trade.Margin = trade.Margin.Div(data.Leverage.Decimal).Round(models.MoneyScale)
+		}
+	}
+	if data.ClosePositionAt.IsZero() {
+		trade.Status = models.TradeStatusOpen
+		trade.ClosePositionAt = nil
+		trade.ExitedQuantity = decimal.Zero
+	} else {
+		closePositionAt := data.ClosePositionAt
+		trade.Status = models.TradeStatusClosed
+		trade.ClosePositionAt = &closePositionAt
+		trade.ExitedQuantity = data.Quantity
+	}
+	trade.ComputePnl()
+}
+
+// resolve replaces the asset and underlying of the form with their catalog
+// symbols. Futures also get their root symbol and contract month, and the
+// point value of the contract as multiplier unless one was given.
+func (data *tradeForm) resolve() error {
+	resolved, err := resolveTradeInstrument(data.Asset, data.OpenPositionAt)
+	if err != nil {
+		return err
+	}
+	data.Asset = resolved.Symbol
+	data.rootSymbol = ""
+	data.contractMultiplier = decimal.Zero
+	if resolved.Instrument != nil && resolved.Instrument.AssetClass == models.AssetClassFuture {
+		data.rootSymbol = resolved.Instrument.Symbol
+		data.contractMultiplier = resolved.Instrument.ContractMultiplier
+		if resolved.ContractMonth != "" {
+			data.ContractMonth = resolved.ContractMonth
+		} else if month, err := time.Parse("2006-01", data.ContractMonth); err == nil {
+			data.Asset = futuresContractSymbol(data.rootSymbol, month.Year(), int(month.Month()))
+		}
+		if data.Multiplier.IsZero() {
+			data.Multiplier = resolved.Instrument.ContractMultiplier
+		}
+	} else {
+		data.ContractMonth = ""
+	}
+
+	// Lots are sized after the standard lot of the instrument, 100000 units
+	// of the base currency for a forex pair
+	data.pipSize = decimal.NullDecimal{}
+	data.quoteCurrency = ""
+	standardLot := decimal.NewFromInt(defaultStandardLot)
+	if resolved.Instrument != nil {
+		data.quoteCurrency = resolved.Instrument.QuoteCurrency
+		if resolved.Instrument.PipSize.Valid {
+			data.pipSize = resolved.Instrument.PipSize
+			standardLot = resolved.Instrument.ContractMultiplier
+		}
+	}
+	if data.LotSize != "" {
+		data.Multiplier = standardLot.Mul(models.LotSizeFractions[data.LotSize])
+	}
+
+	if data.Underlying != "" {
+		data.Underlying, err = resolveAsset(data.Underlying)
+	}
+	return err
+}
+
+// convert sets the ConversionRate of a pip quoted trade from the quote
+// currency of its instrument to the base currency of its account, unless
+// one was given. Trades without an account currency are kept in the quote
+// currency.
+func (data *tradeForm) convert(account *models.Account) error {
+	if !data.pipSize.Valid || data.ConversionRate.Valid {
+		return nil
+	}
+	if account == nil || account.BaseCurrency == "" || data.quoteCurrency == "" {
+		return nil
+	}
+	at := data.OpenPositionAt
+	if !data.ClosePositionAt.IsZero() {
+		at = data.ClosePositionAt
+	}
+	rate, err := findFxRate(data.quoteCurrency, account.BaseCurrency, at)
+	if err != nil {
+		return err
+	}
+	data.ConversionRate = decimal.NewNullDecimal(rate)
+	return nil
+}
+
+// optionSymbol builds the OCC symbol of an option contract, such as
+// AAPL240621C00190000 for the AAPL 190 call expiring on 2024-06-21
+func optionSymbol(trade *models.Trade) string {
+	right := "C"
+	if trade.OptionType == models.OptionTypePut {
+		right = "P"
+	}
+	strike := trade.Strike.Decimal.Shift(3).Truncate(0).String()
+	if len(strike) < 8 {
+		strike = strings.Repeat("0", 8-len(strike)) + strike
+	}
+	return trade.Underlying + trade.Expiry.Format("060102") + right + strike
+}
+
+// newTradeForm pre-populates a form from an existing trade so partial
+// updates only overwrite the fields present in the payload
+func newTradeForm(trade *models.Trade) tradeForm {
+	data := tradeForm{
+		AccountId:             trade.AccountId,
+		TagIds:                make([]string, 0, len(trade.Tags)),
+		Asset:                 trade.Asset,
+		Direction:             trade.Direction,
+		Quantity:              trade.Quantity,
+		OpenPositionAt:        trade.OpenPositionAt,
+		Margin:                trade.Margin,
+		OpenPrice:             trade.OpenPrice,
+		ClosePrice:            trade.ClosePrice,
+		Commission:            trade.Commission,
+		Fees:                  trade.Fees,
+		Swap:                  trade.Swap,
+		Funding:               trade.Funding,
+		StopLoss:              trade.StopLoss,
+		TakeProfit:            trade.TakeProfit,
+		PlannedRisk:           trade.PlannedRisk,
+		OptionType:            trade.OptionType,
+		Underlying:            trade.Underlying,
+		Strike:                trade.Strike,
+		Multiplier:            trade.Multiplier,
+		OptionStrategyId:      trade.OptionStrategyId,
+		ContractMonth:         trade.ContractMonth,
+		rootSymbol:            trade.RootSymbol,
+		Leverage:              trade.Leverage,
+		MarginMode:            trade.MarginMode,
+		MaintenanceMarginRate: trade.MaintenanceMarginRate,
+		LotSize:               trade.LotSize,
+		ConversionRate:        decimal.NewNullDecimal(trade.ConversionRate),
+		Confidence:            trade.Confidence,
+		EmotionBefore:         trade.EmotionBefore,
+		EmotionAfter:          trade.EmotionAfter,
+		Discipline:            trade.Discipline,
+	}
+	if trade.Expiry != nil {
+		data.Expiry = trade.Expiry.Format(time.DateOnly)
+	}
+	for _, tag := range trade.Tags {
+		data.TagIds = append(data.TagIds, tag.TagId)
+	}
+	if trade.ClosePositionAt != nil {
+		data.ClosePositionAt = *trade.ClosePositionAt
+	}
+	return data
+}
+
+func AddTrade(w http.ResponseWriter, r *http.Request) {
 	// Check if Content-Type is application/x-www-form-urlencoded
 	reqHeaders := r.Header
 	fmt.Println(reqHeaders)
@@ -34,8 +447,8 @@ func AddTrade(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse the request body into FormData
-	var data FormData
+	// Parse the request body into the trade form
+	var data tradeForm
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&data); err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -46,81 +459,896 @@ func AddTrade(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate required fields
-	if data.Asset == "" {
+	if message := data.validate(); message != "" {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		// Return error in JSON
-		json.NewEncoder(w).Encode(map[string]string{"error": "Asset is required"})
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
 		return
 	}
-	if data.OpenPositionAt.IsZero() {
+
+	// Spellings of the same instrument are stored as its catalog symbol
+	if err := data.resolve(); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while resolving the asset"})
+		return
+	}
+
+	// Generate a trade ID and get the user ID
+	tradeId := uuid.New()
+	userId, _ := r.Context().Value("username").(string)
+
+	// The account, when given, must belong to the caller
+	var account *models.Account
+	if data.AccountId != "" {
+		found, err := findUserAccount(data.AccountId, userId)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "Account not found"})
+			return
+		}
+		account = found
+	}
+
+	// Money amounts of pip quoted trades are kept in the account currency
+	if err := data.convert(account); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, errFxRateNotFound) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "No FX rate found for the account currency, provide conversionRate"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while converting to the account currency"})
+		return
+	}
+
+	// So must the option strategy the trade is a leg of
+	if data.OptionStrategyId != "" {
+		if _, err := findUserOptionStrategy(data.OptionStrategyId, userId); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "Option strategy not found"})
+			return
+		}
+	}
+
+	// Every tag must belong to the caller
+	tags, err := findUserTags(data.TagIds, userId)
+	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		// Return error in JSON
-		json.NewEncoder(w).Encode(map[string]string{"error": "OpenPositionAt is required"})
+		json.NewEncoder(w).Encode(map[string]string{"error": "Tag not found"})
 		return
 	}
-	if data.ClosePositionAt.IsZero() {
+
+	// Create the trade model
+	trade := &models.Trade{
+		TradId: tradeId.String(),
+		UserId: userId,
+		Tags:   tags,
+	}
+	data.apply(trade)
+	if err := computeCrossLiquidation(trade); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing the liquidation price"})
+		return
+	}
+
+	// Create the trade in the database
+	result := utils.DB.Create(trade)
+	if result.Error != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while adding the trade"})
+		return
+	}
+
+	// Return success with the trade ID in JSON format
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	// Return the created trade ID in JSON
+	json.NewEncoder(w).Encode(map[string]string{"id": tradeId.String()})
+}
+
+// TradeDetailHandler dispatches /trade/{id} to the handler for the request method
+func TradeDetailHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		GetTrade(w, r)
+	case http.MethodPut, http.MethodPatch:
+		UpdateTrade(w, r)
+	case http.MethodDelete:
+		DeleteTrade(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// findUserTrade loads the trade with the given TradId owned by the user.
+// Trades belonging to someone else are reported as not found.
+func findUserTrade(tradeId string, userId string) (*models.Trade, error) {
+	trade := &models.Trade{}
+	result := utils.DB.Preload("Executions", orderExecutions).Preload("Tags").Where("trad_id = ? AND user_id = ?", tradeId, userId).First(trade)
+	return trade, result.Error
+}
+
+func GetTrade(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+	notes, err := findTradeNotes(trade.TradId, userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade notes"})
+		return
+	}
+
+	// Notes are only part of the detail view, not of listings
+	serialized := serializeTrade(*trade)
+	serializedNotes := make([]map[string]interface{}, 0, len(notes))
+	for _, note := range notes {
+		serializedNotes = append(serializedNotes, serializeNote(note))
+	}
+	serialized["notes"] = serializedNotes
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serialized)
+}
+
+// UpdateTrade replaces the trade on PUT and merges the payload into it on
+// PATCH. Either way the result must pass the same validation as AddTrade.
+func UpdateTrade(w http.ResponseWriter, r *http.Request) {
+	// Check if Content-Type is application/x-www-form-urlencoded
+	if !slices.Contains(r.Header["Content-Type"], "application/x-www-form-urlencoded") {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		// Return error in JSON
-		json.NewEncoder(w).Encode(map[string]string{"error": "ClosePositionAt is required"})
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unsupported content type"})
 		return
 	}
 
-	// Additional validation checks for Margin, OpenPrice, and ClosePrice
-	if data.Margin <= 0 {
+	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+
+	// PATCH starts from the stored values, PUT from an empty form
+	var data tradeForm
+	if r.Method == http.MethodPatch {
+		data = newTradeForm(trade)
+	}
+	// The payload is also decoded field by field to tell the stored values
+	// it leaves in place from the ones it sends
+	body, err := io.ReadAll(r.Body)
+	var sent map[string]json.RawMessage
+	if err == nil {
+		err = json.Unmarshal(body, &data)
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &sent)
+	}
+	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		// Return error in JSON
-		json.NewEncoder(w).Encode(map[string]string{"error": "Margin must be greater than 0"})
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
 		return
 	}
-	if data.OpenPrice <= 0 {
+
+	// Validate required fields
+	if message := data.validate(); message != "" {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		// Return error in JSON
-		json.NewEncoder(w).Encode(map[string]string{"error": "OpenPrice must be greater than 0"})
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
 		return
 	}
-	if data.ClosePrice <= 0 {
+
+	// Spellings of the same instrument are stored as its catalog symbol
+	if err := data.resolve(); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while resolving the asset"})
+		return
+	}
+	// The stored multiplier is the point value of the old asset, a new one
+	// takes its own from the catalog unless the payload gives it
+	if _, given := sent["multiplier"]; !given && data.LotSize == "" && data.Asset != trade.Asset {
+		data.Multiplier = data.contractMultiplier
+	}
+
+	// The account, when given, must belong to the caller
+	var account *models.Account
+	if data.AccountId != "" {
+		found, err := findUserAccount(data.AccountId, userId)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "Account not found"})
+			return
+		}
+		account = found
+	}
+
+	// The stored conversion rate is only looked up again when the asset or
+	// the account changes the currencies it converts between
+	if _, given := sent["conversionRate"]; !given && (data.Asset != trade.Asset || data.AccountId != trade.AccountId) {
+		data.ConversionRate = decimal.NullDecimal{}
+	}
+
+	// Money amounts of pip quoted trades are kept in the account currency
+	if err := data.convert(account); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, errFxRateNotFound) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "No FX rate found for the account currency, provide conversionRate"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while converting to the account currency"})
+		return
+	}
+
+	// So must the option strategy the trade is a leg of
+	if data.OptionStrategyId != "" {
+		if _, err := findUserOptionStrategy(data.OptionStrategyId, userId); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "Option strategy not found"})
+			return
+		}
+	}
+
+	// Every tag must belong to the caller
+	tags, err := findUserTags(data.TagIds, userId)
+	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		// Return error in JSON
-		json.NewEncoder(w).Encode(map[string]string{"error": "ClosePrice must be greater than 0"})
+		json.NewEncoder(w).Encode(map[string]string{"error": "Tag not found"})
 		return
 	}
 
-	// Generate a trade ID and get the user ID
-	tradeId := uuid.New()
+	// Funding of a trade with funding payments is always their sum
+	funding, paid, err := fundingPaymentTotal(utils.DB, trade.TradId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the funding payments"})
+		return
+	}
+	if paid {
+		data.Funding = funding
+	}
+
+	// Fields derived from executions always win over the payload
+	data.apply(trade)
+	if err := trade.ApplyExecutions(); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if err := computeCrossLiquidation(trade); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while computing the liquidation price"})
+		return
+	}
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(trade).Error; err != nil {
+			return err
+		}
+		return tx.Model(trade).Association("Tags").Replace(tags)
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while updating the trade"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(serializeTrade(*trade))
+}
+
+// CloseTrade closes an open position. When the payload's quantity is smaller
+// than the position, only that portion is closed: it is split off into a new
+// closed trade linked through ParentTradId, taking its share of the margin
+// and costs, funding payments included, and the rest stays open. Trades
+// journaled with executions are closed by recording an exit execution
+// instead.
+func CloseTrade(w http.ResponseWriter, r *http.Request) {
+	type FormData struct {
+		ClosePositionAt time.Time       `json:"closePositionAt"`
+		ClosePrice      decimal.Decimal `json:"closePrice"`
+		Quantity        decimal.Decimal `json:"quantity"`
+	}
+
 	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+	if !trade.IsOpen() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Trade is already closed"})
+		return
+	}
 
-	// Create the trade model
-	trade := &models.Trade{
-		TradId:         tradeId.String(),
-		Asset:          data.Asset,
-		OpenPositionAt: data.OpenPositionAt,
-		ClosePositionAt: data.ClosePositionAt,
-		Margin:         data.Margin,
-		OpenPrice:      data.OpenPrice,
-		ClosePrice:     data.ClosePrice,
-		UserId:         userId,
+	var data FormData
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Cannot parse request payload"})
+		return
 	}
 
-	// Create the trade in the database
-	result := utils.DB.Create(trade)
+	// Default to closing the whole position now
+	if data.ClosePositionAt.IsZero() {
+		data.ClosePositionAt = time.Now()
+	}
+	openQuantity := trade.Quantity.Sub(trade.ExitedQuantity)
+	if data.Quantity.IsZero() {
+		data.Quantity = openQuantity
+	}
+	// Options can be closed for nothing, like in validate
+	if data.ClosePrice.Sign() < 0 || (data.ClosePrice.IsZero() && !trade.IsOption()) {
+		message := "ClosePrice must be greater than 0"
+		if trade.IsOption() {
+			message = "ClosePrice must not be negative"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+	if data.ClosePositionAt.Before(trade.OpenPositionAt) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "ClosePositionAt must not be before OpenPositionAt"})
+		return
+	}
+	if data.Quantity.Sign() <= 0 || data.Quantity.GreaterThan(openQuantity) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "Quantity must be greater than 0 and at most the open quantity"})
+		return
+	}
+
+	if len(trade.Executions) > 0 {
+		closeTradeWithExecution(w, trade, models.Execution{
+			Side:       oppositeSide(trade.EntrySide()),
+			Quantity:   data.Quantity,
+			Price:      data.ClosePrice,
+			ExecutedAt: data.ClosePositionAt,
+		})
+		return
+	}
+
+	closed := trade
+	var remaining *models.Trade
+	var payments, movedPayments []models.FundingPayment
+	if data.Quantity.LessThan(trade.Quantity) {
+		remaining = trade
+		share := func(amount decimal.Decimal) decimal.Decimal {
+			return amount.Mul(data.Quantity).Div(trade.Quantity).Round(models.MoneyScale)
+		}
+		result := utils.DB.Where("trad_id = ?", trade.TradId).Find(&payments)
+		if result.Error != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the funding payments"})
+			return
+		}
+		closed = &models.Trade{
+			TradId:                uuid.New().String(),
+			UserId:                trade.UserId,
+			AccountId:             trade.AccountId,
+			ParentTradId:          trade.TradId,
+			Tags:                  trade.Tags,
+			Asset:                 trade.Asset,
+			OptionContract:        trade.OptionContract,
+			FuturesContract:       trade.FuturesContract,
+			ForexPosition:         trade.ForexPosition,
+			TradePsychology:       trade.TradePsychology,
+			OptionStrategyId:      trade.OptionStrategyId,
+			Direction:             trade.Direction,
+			Quantity:              data.Quantity,
+			Multiplier:            trade.Multiplier,
+			OpenPositionAt:        trade.OpenPositionAt,
+			OpenPrice:             trade.OpenPrice,
+			Margin:                share(trade.Margin),
+			Leverage:              trade.Leverage,
+			MarginMode:            trade.MarginMode,
+			MaintenanceMarginRate: trade.MaintenanceMarginRate,
+			LiquidationPrice:      trade.LiquidationPrice,
+			Commission:            share(trade.Commission),
+			Fees:                  share(trade.Fees),
+			Swap:                  share(trade.Swap),
+			Funding:               share(trade.Funding),
+			StopLoss:              trade.StopLoss,
+			TakeProfit:            trade.TakeProfit,
+		}
+		// Funding paid in payments is split payment by payment
+		if len(payments) > 0 {
+			movedPayments, closed.Funding = splitFundingPayments(payments, closed.TradId, share)
+		}
+		if trade.PlannedRisk.Valid {
+			closed.PlannedRisk = decimal.NewNullDecimal(share(trade.PlannedRisk.Decimal))
+			remaining.PlannedRisk.Decimal = remaining.PlannedRisk.Decimal.Sub(closed.PlannedRisk.Decimal)
+		}
+		remaining.Quantity = remaining.Quantity.Sub(data.Quantity)
+		remaining.Margin = remaining.Margin.Sub(closed.Margin)
+		remaining.Commission = remaining.Commission.Sub(closed.Commission)
+		remaining.Fees = remaining.Fees.Sub(closed.Fees)
+		remaining.Swap = remaining.Swap.Sub(closed.Swap)
+		remaining.Funding = remaining.Funding.Sub(closed.Funding)
+		remaining.ComputePnl()
+	}
+	closePositionAt := data.ClosePositionAt
+	closed.Status = models.TradeStatusClosed
+	closed.ClosePositionAt = &closePositionAt
+	closed.ClosePrice = data.ClosePrice
+	closed.ExitedQuantity = closed.Quantity
+	closed.ComputePnl()
+
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		if remaining == nil {
+			return tx.Omit(clause.Associations).Save(closed).Error
+		}
+		if err := tx.Omit(clause.Associations).Save(remaining).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(closed).Error; err != nil {
+			return err
+		}
+		for i := range payments {
+			if err := tx.Save(&payments[i]).Error; err != nil {
+				return err
+			}
+		}
+		if len(movedPayments) > 0 {
+			return tx.Create(&movedPayments).Error
+		}
+		return nil
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while closing the trade"})
+		return
+	}
+
+	resp := map[string]interface{}{
+		"closed":    serializeTrade(*closed),
+		"remaining": nil,
+	}
+	if remaining != nil {
+		resp["remaining"] = serializeTrade(*remaining)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// DeleteTrade soft deletes the trade through gorm.Model.DeletedAt, along
+// with the closed trades split off from it and the executions, notes and
+// funding payments of either. Their attachments are removed for good, files
+// included.
+func DeleteTrade(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	trade, err := findUserTrade(r.PathValue("id"), userId)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Trade not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while fetching the trade"})
+		return
+	}
+
+	var objectKeys []string
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		tradeIds := []string{trade.TradId}
+		var children []string
+		result := tx.Model(&models.Trade{}).Where("parent_trad_id = ? AND user_id = ?", trade.TradId, userId).Pluck("trad_id", &children)
+		if result.Error != nil {
+			return result.Error
+		}
+		tradeIds = append(tradeIds, children...)
+		for _, model := range []interface{}{&models.Execution{}, &models.Note{}, &models.FundingPayment{}} {
+			if err := tx.Where("trad_id IN ?", tradeIds).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		// Attachment rows go for good like in DeleteAttachment, since their
+		// files are deleted below
+		result = tx.Model(&models.Attachment{}).Where("trad_id IN ?", tradeIds).Pluck("object_key", &objectKeys)
+		if result.Error != nil {
+			return result.Error
+		}
+		if err := tx.Unscoped().Where("trad_id IN ?", tradeIds).Delete(&models.Attachment{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("trad_id IN ?", tradeIds).Delete(&models.Trade{}).Error
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while deleting the trade"})
+		return
+	}
+
+	// Files are only deleted once the trade is, so a failed delete never
+	// leaves an attachment pointing at a missing file. A file that cannot be
+	// deleted is left behind in storage.
+	for _, objectKey := range objectKeys {
+		if err := utils.Storage.DeleteObject(r.Context(), utils.StorageBucket, objectKey); err != nil {
+			log.Printf("Couldn't delete %v:%v of deleted trade %v. Here's why: %v\n", utils.StorageBucket, objectKey, trade.TradId, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListTrades returns the caller's trades filtered by the query string.
+// Results are paginated with an opaque cursor pointing at the last trade of
+// the previous page, so deep pages never need an OFFSET scan.
+func ListTrades(w http.ResponseWriter, r *http.Request) {
+	userId, _ := r.Context().Value("username").(string)
+	query := r.URL.Query()
+
+	// Resolve the sort column against the Trade schema
+	stmt := &gorm.Statement{DB: utils.DB}
+	if err := stmt.Parse(&models.Trade{}); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while listing trades"})
+		return
+	}
+	sortField := stmt.Schema.LookUpField("open_position_at")
+	if sortParam := query.Get("sort"); sortParam != "" {
+		sortField = lookUpTradeField(stmt.Schema, sortParam)
+		if sortField == nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "Unsupported sort column"})
+			return
+		}
+	}
+
+	order := strings.ToLower(query.Get("order"))
+	if order == "" {
+		order = "desc"
+	}
+	if order != "asc" && order != "desc" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": "order must be asc or desc"})
+		return
+	}
+
+	limit := defaultTradePageSize
+	if limitParam := query.Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed <= 0 || parsed > maxTradePageSize {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", maxTradePageSize)})
+			return
+		}
+		limit = parsed
+	}
+
+	tx, message := filterUserTrades(userId, query)
+	if message != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		// Return error in JSON
+		json.NewEncoder(w).Encode(map[string]string{"error": message})
+		return
+	}
+
+	// Continue after the trade the cursor points at, using the trade ID as a
+	// tie breaker so rows sharing the same sort value are never skipped
+	column := stmt.Quote(sortField.DBName)
+	if cursor := query.Get("cursor"); cursor != "" {
+		cursorId, err := decodeTradeCursor(cursor)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			// Return error in JSON
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid cursor"})
+			return
+		}
+		cursorValue := fmt.Sprintf("(SELECT %s FROM %s WHERE id = @cursor AND user_id = @user)", column, stmt.Quote(stmt.Schema.Table))
+		condition := "(%[1]s > %[2]s OR (%[1]s IS NOT DISTINCT FROM %[2]s AND id > @cursor) OR (%[1]s IS NULL AND %[2]s IS NOT NULL))"
+		if order == "desc" {
+			condition = "(%[1]s < %[2]s OR (%[1]s IS NOT DISTINCT FROM %[2]s AND id < @cursor) OR (%[1]s IS NOT NULL AND %[2]s IS NULL))"
+		}
+		tx = tx.Where(fmt.Sprintf(condition, column, cursorValue), sql.Named("cursor", cursorId), sql.Named("user", userId))
+	}
+
+	// Fetch one extra row to know whether another page exists
+	var trades []models.Trade
+	result := tx.Preload("Executions", orderExecutions).Preload("Tags").Order(fmt.Sprintf("%s %s, id %s", column, order, order)).Limit(limit + 1).Find(&trades)
 	if result.Error != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		// Return error in JSON
-		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while adding the trade"})
+		json.NewEncoder(w).Encode(map[string]string{"error": "An error occurred while listing trades"})
 		return
 	}
 
-	// Return success with the trade ID in JSON format
+	var nextCursor *string
+	if len(trades) > limit {
+		trades = trades[:limit]
+		cursor := encodeTradeCursor(trades[limit-1].ID)
+		nextCursor = &cursor
+	}
+
+	serialized := make([]map[string]interface{}, 0, len(trades))
+	for _, trade := range trades {
+		serialized = append(serialized, serializeTrade(trade))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	// Return the created trade ID in JSON
-	json.NewEncoder(w).Encode(map[string]string{"id": tradeId.String()})
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"trades":     serialized,
+		"nextCursor": nextCursor,
+	})
 }
 
+// filterUserTrades scopes a trade query to the user and applies the filters
+// shared by the trade listing and analytics endpoints. Columns are qualified
+// so analytics can join other tables onto trades. It returns an error
+// message when a filter value is invalid.
+func filterUserTrades(userId string, query url.Values) (*gorm.DB, string) {
+	tx := utils.DB.Model(&models.Trade{}).Where("trades.user_id = ?", userId)
+
+	// Filter by one or more comma separated accounts
+	if account := query.Get("account"); account != "" {
+		tx = tx.Where("trades.account_id IN ?", strings.Split(account, ","))
+	}
+
+	// Filter by one or more comma separated assets
+	if asset := query.Get("asset"); asset != "" {
+		tx = tx.Where("trades.asset IN ?", strings.Split(asset, ","))
+	}
+
+	// Filter by position status
+	if status := query.Get("status"); status != "" {
+		if status != models.TradeStatusOpen && status != models.TradeStatusClosed {
+			return nil, "status must be open or closed"
+		}
+		tx = tx.Where("trades.status = ?", status)
+	}
+
+	// Filter by one or more comma separated tags or strategies, matching
+	// trades that carry any of them
+	if tag := query.Get("tag"); tag != "" {
+		tx = tx.Where("EXISTS (SELECT 1 FROM trade_tags WHERE trade_tags.trad_id = trades.trad_id AND trade_tags.tag_id IN ?)", strings.Split(tag, ","))
+	}
+
+	// Filter by trade direction
+	if direction := query.Get("direction"); direction != "" {
+		tx = tx.Where("trades.direction = ?", direction)
+	}
+
+	// Filter by open and close date ranges
+	dateFilters := []struct {
+		param     string
+		condition string
+	}{
+		{"openFrom", "trades.open_position_at >= ?"},
+		{"openTo", "trades.open_position_at <= ?"},
+		{"closeFrom", "trades.close_position_at >= ?"},
+		{"closeTo", "trades.close_position_at <= ?"},
+	}
+	for _, filter := range dateFilters {
+		value := query.Get(filter.param)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, filter.param + " must be an RFC3339 timestamp"
+		}
+		tx = tx.Where(filter.condition, date)
+	}
+
+	// Start a new session so callers can run several queries off the filters
+	return tx.Session(&gorm.Session{}), ""
+}
+
+// lookUpTradeField accepts a column as its DB name, Go field name or the
+// camelCase key used in trade responses
+func lookUpTradeField(tradeSchema *schema.Schema, name string) *schema.Field {
+	field := tradeSchema.LookUpField(name)
+	if field == nil && name != "" {
+		field = tradeSchema.LookUpField(strings.ToUpper(name[:1]) + name[1:])
+	}
+	if field == nil || field.DBName == "" {
+		return nil
+	}
+	return field
+}
+
+func encodeTradeCursor(id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(id), 10)))
+}
+
+func decodeTradeCursor(cursor string) (uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(string(raw), 10, 64)
+	return uint(id), err
+}
+
+// serializeTrade builds the JSON representation of a trade returned by the API
+func serializeTrade(trade models.Trade) map[string]interface{} {
+	var closePrice *decimal.Decimal
+	if !trade.ExitedQuantity.IsZero() {
+		closePrice = &trade.ClosePrice
+	}
+	executions := make([]map[string]interface{}, 0, len(trade.Executions))
+	for _, execution := range trade.Executions {
+		executions = append(executions, serializeExecution(execution))
+	}
+	tags := make([]map[string]interface{}, 0, len(trade.Tags))
+	for _, tag := range trade.Tags {
+		tags = append(tags, serializeTag(tag))
+	}
+	var option map[string]interface{}
+	if trade.IsOption() {
+		option = map[string]interface{}{
+			"type":              trade.OptionType,
+			"underlying":        trade.Underlying,
+			"strike":            trade.Strike,
+			"expiry":            nil,
+			"expirationOutcome": trade.ExpirationOutcome,
+		}
+		if trade.Expiry != nil {
+			option["expiry"] = trade.Expiry.Format(time.DateOnly)
+		}
+	}
+	var futures map[string]interface{}
+	if trade.IsFuture() {
+		futures = map[string]interface{}{
+			"rootSymbol":    trade.RootSymbol,
+			"contractMonth": trade.ContractMonth,
+			"rolledFromId":  trade.RolledFromTradId,
+		}
+	}
+	var forex map[string]interface{}
+	if trade.PipSize.Valid {
+		forex = map[string]interface{}{
+			"lotSize":        trade.LotSize,
+			"pipSize":        trade.PipSize,
+			"pipValue":       trade.PipValue(),
+			"pips":           trade.Pips,
+			"conversionRate": trade.QuoteConversion(),
+		}
+	}
+	psychology := map[string]interface{}{
+		"confidence":    trade.Confidence,
+		"emotionBefore": trade.EmotionBefore,
+		"emotionAfter":  trade.EmotionAfter,
+		"discipline":    trade.Discipline,
+	}
+	return map[string]interface{}{
+		"id":                    trade.TradId,
+		"accountId":             trade.AccountId,
+		"parentId":              trade.ParentTradId,
+		"optionStrategyId":      trade.OptionStrategyId,
+		"asset":                 trade.Asset,
+		"option":                option,
+		"futures":               futures,
+		"forex":                 forex,
+		"psychology":            psychology,
+		"status":                trade.Status,
+		"direction":             trade.Direction,
+		"quantity":              trade.Quantity,
+		"multiplier":            trade.ContractMultiplier(),
+		"exitedQuantity":        trade.ExitedQuantity,
+		"openPositionAt":        trade.OpenPositionAt,
+		"closePositionAt":       trade.ClosePositionAt,
+		"margin":                trade.Margin,
+		"leverage":              trade.Leverage,
+		"marginMode":            trade.MarginMode,
+		"maintenanceMarginRate": trade.MaintenanceMarginRate,
+		"liquidationPrice":      trade.LiquidationPrice,
+		"openPrice":             trade.OpenPrice,
+		"closePrice":            closePrice,
+		"commission":            trade.Commission,
+		"fees":                  trade.Fees,
+		"swap":                  trade.Swap,
+		"funding":               trade.Funding,
+		"executionFees":         trade.ExecutionFees,
+		"totalCosts":            trade.TotalCosts(),
+		"realizedPnl":           trade.RealizedPnl,
+		"returnPct":             trade.ReturnPct,
+		"returnOnMargin":        trade.ReturnOnMargin,
+		"netPnl":                trade.NetPnl,
+		"netReturnPct":          trade.NetReturnPct,
+		"netReturnOnMargin":     trade.NetReturnOnMargin,
+		"stopLoss":              trade.StopLoss,
+		"takeProfit":            trade.TakeProfit,
+		"plannedRisk":           trade.PlannedRisk,
+		"initialRisk":           trade.InitialRisk,
+		"plannedRewardRisk":     trade.PlannedRewardRisk,
+		"rMultiple":             trade.RMultiple,
+		"executions":            executions,
+		"tags":                  tags,
+		"createdAt":             trade.CreatedAt,
+		"updatedAt":             trade.UpdatedAt,
+	}
+}
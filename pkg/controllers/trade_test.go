@@ -0,0 +1,476 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/abdullahelwalid/tradelog-go/pkg/utils"
+	"github.com/shopspring/decimal"
+)
+
+// listTrades runs ListTrades for the user and returns the IDs of the listed
+// trades with the cursor of the next page
+func listTrades(t *testing.T, userId string, query url.Values) (int, []string, string) {
+	t.Helper()
+	r := asUser(httptest.NewRequest(http.MethodGet, "/trade?"+query.Encode(), nil), userId)
+	w := httptest.NewRecorder()
+	ListTrades(w, r)
+	if w.Code != http.StatusOK {
+		return w.Code, nil, ""
+	}
+	var response struct {
+		Trades []struct {
+			Id string `json:"id"`
+		} `json:"trades"`
+		NextCursor *string `json:"nextCursor"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+	}
+	ids := []string{}
+	for _, trade := range response.Trades {
+		ids = append(ids, trade.Id)
+	}
+	cursor := ""
+	if response.NextCursor != nil {
+		cursor = *response.NextCursor
+	}
+	return w.Code, ids, cursor
+}
+
+func TestListTrades(t *testing.T) {
+	useTestDB(t)
+	day := func(n int) time.Time {
+		return time.Date(2024, 3, n, 14, 30, 0, 0, time.UTC)
+	}
+	createTestUser(t, "alice")
+	createTestUser(t, "bob")
+	trades := []models.Trade{
+		{TradId: "trade-1", UserId: "alice", Asset: "AAPL", OpenPositionAt: day(1), OpenPrice: decimal.NewFromInt(100)},
+		{TradId: "trade-2", UserId: "alice", Asset: "MSFT", Status: models.TradeStatusOpen, OpenPositionAt: day(2), OpenPrice: decimal.NewFromInt(300)},
+		{TradId: "trade-3", UserId: "alice", Asset: "AAPL", Direction: models.TradeDirectionShort, OpenPositionAt: day(3), OpenPrice: decimal.NewFromInt(110)},
+		// Opened together with trade-3, so only the ID orders them
+		{TradId: "trade-4", UserId: "alice", Asset: "AAPL", OpenPositionAt: day(3), OpenPrice: decimal.NewFromInt(90)},
+		{TradId: "trade-5", UserId: "bob", Asset: "AAPL", OpenPositionAt: day(2), OpenPrice: decimal.NewFromInt(100)},
+	}
+	if err := utils.DB.Create(&trades).Error; err != nil {
+		t.Fatalf("creating trades: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+		pages [][]string
+	}{
+		{"newest first by default", url.Values{}, [][]string{{"trade-4", "trade-3", "trade-2", "trade-1"}}},
+		{"paged", url.Values{"limit": {"3"}}, [][]string{{"trade-4", "trade-3", "trade-2"}, {"trade-1"}}},
+		{"paged through ties", url.Values{"limit": {"1"}, "order": {"asc"}}, [][]string{{"trade-1"}, {"trade-2"}, {"trade-3"}, {"trade-4"}}},
+		{"by asset", url.Values{"asset": {"AAPL"}, "order": {"asc"}}, [][]string{{"trade-1", "trade-3", "trade-4"}}},
+		{"by several assets", url.Values{"asset": {"MSFT,TSLA"}}, [][]string{{"trade-2"}}},
+		{"by status", url.Values{"status": {models.TradeStatusOpen}}, [][]string{{"trade-2"}}},
+		{"by direction", url.Values{"direction": {models.TradeDirectionShort}}, [][]string{{"trade-3"}}},
+		{"by open date", url.Values{"openFrom": {day(2).Format(time.RFC3339)}, "openTo": {day(2).Format(time.RFC3339)}}, [][]string{{"trade-2"}}},
+		{"sorted by another column", url.Values{"sort": {"openPrice"}, "limit": {"2"}}, [][]string{{"trade-2", "trade-3"}, {"trade-1", "trade-4"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			for i, want := range tt.pages {
+				code, ids, cursor := listTrades(t, "alice", query)
+				if code != http.StatusOK {
+					t.Fatalf("page %d: ListTrades() status = %d, want %d", i, code, http.StatusOK)
+				}
+				if !reflect.DeepEqual(ids, want) {
+					t.Errorf("page %d = %v, want %v", i, ids, want)
+				}
+				if (cursor == "") != (i == len(tt.pages)-1) {
+					t.Fatalf("page %d: nextCursor = %q, want one only before the last page", i, cursor)
+				}
+				query.Set("cursor", cursor)
+			}
+		})
+	}
+}
+
+func TestListTradesRejectsInvalidQueries(t *testing.T) {
+	useTestDB(t)
+	tests := []struct {
+		name  string
+		query url.Values
+	}{
+		{"unknown sort column", url.Values{"sort": {"password"}}},
+		{"unknown order", url.Values{"order": {"up"}}},
+		{"unknown status", url.Values{"status": {"pending"}}},
+		{"zero limit", url.Values{"limit": {"0"}}},
+		{"limit over the maximum", url.Values{"limit": {"1000"}}},
+		{"date without a zone", url.Values{"openFrom": {"2024-03-01"}}},
+		{"invalid cursor", url.Values{"cursor": {"not a cursor"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _, _ := listTrades(t, "alice", tt.query); code != http.StatusBadRequest {
+				t.Errorf("ListTrades() status = %d, want %d", code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+// serveTrade runs TradeDetailHandler on the trade for the user and decodes
+// the JSON response
+func serveTrade(t *testing.T, method string, userId string, tradeId string, body string) (int, map[string]interface{}) {
+	t.Helper()
+	r := asUser(httptest.NewRequest(method, "/trade/"+tradeId, strings.NewReader(body)), userId)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetPathValue("id", tradeId)
+	w := httptest.NewRecorder()
+	TradeDetailHandler(w, r)
+	var response map[string]interface{}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code, response
+}
+
+func TestTradeDetail(t *testing.T) {
+	useTestDB(t)
+	createTestUser(t, "alice")
+	trade := &models.Trade{
+		TradId:         "trade-1",
+		UserId:         "alice",
+		Asset:          "AAPL",
+		Status:         models.TradeStatusOpen,
+		Direction:      models.TradeDirectionLong,
+		Quantity:       decimal.NewFromInt(10),
+		OpenPositionAt: time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC),
+		Margin:         decimal.NewFromInt(1000),
+		OpenPrice:      decimal.NewFromInt(100),
+	}
+	if err := utils.DB.Create(trade).Error; err != nil {
+		t.Fatalf("creating trade: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		userId string
+		body   string
+		status int
+		margin string
+	}{
+		{"get", http.MethodGet, "alice", "", http.StatusOK, "1000"},
+		{"get by another user", http.MethodGet, "bob", "", http.StatusNotFound, "1000"},
+		{"patch", http.MethodPatch, "alice", `{"margin": 1500}`, http.StatusOK, "1500"},
+		{"patch by another user", http.MethodPatch, "bob", `{"margin": 2000}`, http.StatusNotFound, "1500"},
+		{"put without required fields", http.MethodPut, "alice", `{"margin": 2000}`, http.StatusBadRequest, "1500"},
+		{"patch to an invalid trade", http.MethodPatch, "alice", `{"openPrice": 0}`, http.StatusBadRequest, "1500"},
+		{"delete by another user", http.MethodDelete, "bob", "", http.StatusNotFound, "1500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := serveTrade(t, tt.method, tt.userId, "trade-1", tt.body)
+			if code != tt.status {
+				t.Fatalf("%s status = %d, want %d: %v", tt.method, code, tt.status, response)
+			}
+			stored, err := findUserTrade("trade-1", "alice")
+			if err != nil {
+				t.Fatalf("findUserTrade() error = %v", err)
+			}
+			if !stored.Margin.Equal(decimal.RequireFromString(tt.margin)) {
+				t.Errorf("Margin = %s, want %s", stored.Margin, tt.margin)
+			}
+			if stored.Asset != "AAPL" || !stored.OpenPrice.Equal(decimal.NewFromInt(100)) {
+				t.Errorf("stored trade = %s at %v, want the fields left out of the payload kept", stored.Asset, stored.OpenPrice)
+			}
+		})
+	}
+
+	if code, response := serveTrade(t, http.MethodDelete, "alice", "trade-1", ""); code != http.StatusNoContent {
+		t.Fatalf("DELETE status = %d, want %d: %v", code, http.StatusNoContent, response)
+	}
+	if code, _ := serveTrade(t, http.MethodGet, "alice", "trade-1", ""); code != http.StatusNotFound {
+		t.Errorf("GET after DELETE status = %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+// ratingOf returns a pointer to the psychology rating
+func ratingOf(rating int) *int {
+	return &rating
+}
+
+func TestTradeFormValidate(t *testing.T) {
+	openAt := time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC)
+	closeAt := openAt.Add(time.Hour)
+	earlier := openAt.Add(-time.Hour)
+	valid := tradeForm{Asset: "AAPL", Direction: models.TradeDirectionLong, Quantity: decimal.NewFromInt(10), OpenPositionAt: openAt, Margin: decimal.NewFromInt(1000), OpenPrice: decimal.NewFromInt(100)}
+	option := tradeForm{Asset: "AAPL 240621C00100000", OptionType: models.OptionTypeCall, Underlying: "AAPL", Strike: decimal.NewNullDecimal(decimal.NewFromInt(100)), Expiry: "2024-06-21", Direction: models.TradeDirectionLong, Quantity: decimal.NewFromInt(1), OpenPositionAt: openAt, OpenPrice: decimal.NewFromInt(2)}
+	tests := []struct {
+		name    string
+		edit    func(data *tradeForm)
+		message string
+	}{
+		{"open position", func(data *tradeForm) {}, ""},
+		{"closed position", func(data *tradeForm) { data.ClosePositionAt, data.ClosePrice = closeAt, decimal.NewFromInt(110) }, ""},
+		{"missing asset", func(data *tradeForm) { data.Asset = "" }, "Asset is required"},
+		{"unknown direction", func(data *tradeForm) { data.Direction = "sideways" }, "Direction must be long or short"},
+		{"no quantity", func(data *tradeForm) { data.Quantity = decimal.Zero }, "Quantity must be greater than 0"},
+		{"missing open time", func(data *tradeForm) { data.OpenPositionAt = time.Time{} }, "OpenPositionAt is required"},
+		{"no margin", func(data *tradeForm) { data.Margin = decimal.Zero }, "Margin must be greater than 0"},
+		{"negative margin", func(data *tradeForm) { data.Margin = decimal.NewFromInt(-1) }, "Margin must not be negative"},
+		{"no open price", func(data *tradeForm) { data.OpenPrice = decimal.Zero }, "OpenPrice must be greater than 0"},
+		{"negative commission", func(data *tradeForm) { data.Commission = decimal.NewFromInt(-1) }, "Commission must not be negative"},
+		{"negative fees", func(data *tradeForm) { data.Fees = decimal.NewFromInt(-1) }, "Fees must not be negative"},
+		{"received swap", func(data *tradeForm) { data.Swap = decimal.NewFromInt(-1) }, ""},
+		{"negative close price", func(data *tradeForm) { data.ClosePositionAt, data.ClosePrice = closeAt, decimal.NewFromInt(-1) }, "ClosePrice must not be negative"},
+		{"close time only", func(data *tradeForm) { data.ClosePositionAt = closeAt }, "ClosePositionAt and ClosePrice must be provided together"},
+		{"close price only", func(data *tradeForm) { data.ClosePrice = decimal.NewFromInt(110) }, "ClosePositionAt and ClosePrice must be provided together"},
+		{"closed before opened", func(data *tradeForm) { data.ClosePositionAt, data.ClosePrice = earlier, decimal.NewFromInt(110) }, "ClosePositionAt must not be before OpenPositionAt"},
+		{"long trade plan", func(data *tradeForm) {
+			data.StopLoss, data.TakeProfit = decimal.NewNullDecimal(decimal.NewFromInt(95)), decimal.NewNullDecimal(decimal.NewFromInt(110))
+		}, ""},
+		{"long stop above entry", func(data *tradeForm) { data.StopLoss = decimal.NewNullDecimal(decimal.NewFromInt(105)) }, "StopLoss must be on the losing side of OpenPrice"},
+		{"long target below entry", func(data *tradeForm) { data.TakeProfit = decimal.NewNullDecimal(decimal.NewFromInt(95)) }, "TakeProfit must be on the winning side of OpenPrice"},
+		{"short stop above entry", func(data *tradeForm) {
+			data.Direction, data.StopLoss = models.TradeDirectionShort, decimal.NewNullDecimal(decimal.NewFromInt(105))
+		}, ""},
+		{"short stop below entry", func(data *tradeForm) {
+			data.Direction, data.StopLoss = models.TradeDirectionShort, decimal.NewNullDecimal(decimal.NewFromInt(95))
+		}, "StopLoss must be on the losing side of OpenPrice"},
+		{"no planned risk", func(data *tradeForm) { data.PlannedRisk = decimal.NewNullDecimal(decimal.Zero) }, "PlannedRisk must be greater than 0"},
+		{"psychology ratings", func(data *tradeForm) {
+			data.Confidence, data.EmotionBefore, data.EmotionAfter, data.Discipline = ratingOf(models.RatingMin), ratingOf(3), ratingOf(4), ratingOf(models.RatingMax)
+		}, ""},
+		{"rating below the scale", func(data *tradeForm) { data.Confidence = ratingOf(models.RatingMin - 1) }, "Confidence must be between 1 and 5"},
+		{"rating above the scale", func(data *tradeForm) { data.Discipline = ratingOf(models.RatingMax + 1) }, "Discipline must be between 1 and 5"},
+		{"long call", func(data *tradeForm) { *data = option }, ""},
+		{"option without asset", func(data *tradeForm) { *data, data.Asset = option, "" }, ""},
+		{"unknown option type", func(data *tradeForm) { *data, data.OptionType = option, "future" }, "OptionType must be call or put"},
+		{"option without underlying", func(data *tradeForm) { *data, data.Underlying = option, "" }, "Underlying is required for options"},
+		{"option without strike", func(data *tradeForm) { *data, data.Strike = option, decimal.NullDecimal{} }, "Strike must be greater than 0"},
+		{"option with a malformed expiry", func(data *tradeForm) { *data, data.Expiry = option, "21/06/2024" }, "Expiry must be a date formatted as 2006-01-02"},
+		{"negative multiplier", func(data *tradeForm) { data.Multiplier = decimal.NewFromInt(-1) }, "Multiplier must not be negative"},
+		{"long option without margin", func(data *tradeForm) { *data, data.Margin = option, decimal.Zero }, ""},
+		{"short option without margin", func(data *tradeForm) {
+			*data, data.Direction, data.Margin = option, models.TradeDirectionShort, decimal.Zero
+		}, "Margin must be greater than 0"},
+		{"option closed for nothing", func(data *tradeForm) { *data, data.ClosePositionAt = option, closeAt }, ""},
+		{"option close price only", func(data *tradeForm) { *data, data.ClosePrice = option, decimal.NewFromInt(1) }, "ClosePositionAt and ClosePrice must be provided together"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := valid
+			tt.edit(&data)
+			if message := data.validate(); message != tt.message {
+				t.Errorf("validate() = %q, want %q", message, tt.message)
+			}
+		})
+	}
+}
+
+// closeTrade runs CloseTrade on the trade for the user and decodes the JSON
+// response
+func closeTrade(t *testing.T, userId string, tradeId string, body string) (int, map[string]interface{}) {
+	t.Helper()
+	r := asUser(httptest.NewRequest(http.MethodPost, "/trade/"+tradeId+"/close", strings.NewReader(body)), userId)
+	r.SetPathValue("id", tradeId)
+	w := httptest.NewRecorder()
+	CloseTrade(w, r)
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, response
+}
+
+func TestCloseTrade(t *testing.T) {
+	useTestDB(t)
+	createTestTrade(t, "trade-1", "alice")
+
+	tests := []struct {
+		name   string
+		userId string
+		body   string
+		status int
+	}{
+		{"another user", "bob", `{"closePrice": 110}`, http.StatusNotFound},
+		{"no close price", "alice", `{"quantity": 4}`, http.StatusBadRequest},
+		{"negative quantity", "alice", `{"closePrice": 110, "quantity": -4}`, http.StatusBadRequest},
+		{"more than the open quantity", "alice", `{"closePrice": 110, "quantity": 12}`, http.StatusBadRequest},
+		{"before the open", "alice", `{"closePrice": 110, "closePositionAt": "2024-03-01T00:00:00Z"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, response := closeTrade(t, tt.userId, "trade-1", tt.body)
+			if code != tt.status {
+				t.Errorf("CloseTrade() status = %d, want %d: %v", code, tt.status, response)
+			}
+		})
+	}
+
+	code, response := closeTrade(t, "alice", "trade-1", `{"closePrice": 110, "quantity": 4, "closePositionAt": "2024-03-05T15:00:00Z"}`)
+	if code != http.StatusOK {
+		t.Fatalf("partial CloseTrade() status = %d: %v", code, response)
+	}
+	closed := response["closed"].(map[string]interface{})
+	remaining := response["remaining"].(map[string]interface{})
+	if closed["parentId"] != "trade-1" || closed["status"] != models.TradeStatusClosed || closed["quantity"] != "4" || closed["margin"] != "400" || closed["realizedPnl"] != "40" {
+		t.Errorf("closed = %v, want 4 of trade-1 closed for 40", closed)
+	}
+	if remaining["id"] != "trade-1" || remaining["status"] != models.TradeStatusOpen || remaining["quantity"] != "6" || remaining["margin"] != "600" {
+		t.Errorf("remaining = %v, want 6 of trade-1 left open", remaining)
+	}
+
+	code, response = closeTrade(t, "alice", "trade-1", `{"closePrice": 90, "closePositionAt": "2024-03-06T15:00:00Z"}`)
+	if code != http.StatusOK {
+		t.Fatalf("CloseTrade() status = %d: %v", code, response)
+	}
+	closed = response["closed"].(map[string]interface{})
+	if closed["id"] != "trade-1" || closed["status"] != models.TradeStatusClosed || closed["quantity"] != "6" || closed["realizedPnl"] != "-60" || response["remaining"] != nil {
+		t.Errorf("closed = %v, want the rest of trade-1 closed for -60", closed)
+	}
+
+	if code, response := closeTrade(t, "alice", "trade-1", `{"closePrice": 100}`); code != http.StatusConflict {
+		t.Errorf("CloseTrade() of a closed trade status = %d, want %d: %v", code, http.StatusConflict, response)
+	}
+}
+
+func TestCloseOptionTrade(t *testing.T) {
+	useTestDB(t)
+	createTestUser(t, "alice")
+	expiry := time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)
+	for _, tradeId := range []string{"stock-1", "call-1"} {
+		trade := &models.Trade{
+			TradId:         tradeId,
+			UserId:         "alice",
+			Asset:          "AAPL",
+			Status:         models.TradeStatusOpen,
+			Direction:      models.TradeDirectionLong,
+			Quantity:       decimal.NewFromInt(1),
+			Multiplier:     decimal.NewFromInt(1),
+			OpenPositionAt: time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC),
+			Margin:         decimal.NewFromInt(200),
+			OpenPrice:      decimal.NewFromInt(2),
+		}
+		if tradeId == "call-1" {
+			trade.Multiplier = decimal.NewFromInt(models.DefaultOptionMultiplier)
+			trade.OptionContract = models.OptionContract{OptionType: models.OptionTypeCall, Underlying: "AAPL", Strike: decimal.NewNullDecimal(decimal.NewFromInt(100)), Expiry: &expiry}
+		}
+		if err := utils.DB.Create(trade).Error; err != nil {
+			t.Fatalf("creating trade %s: %v", tradeId, err)
+		}
+	}
+
+	if code, response := closeTrade(t, "alice", "stock-1", `{"closePrice": 0}`); code != http.StatusBadRequest || response["error"] != "ClosePrice must be greater than 0" {
+		t.Errorf("CloseTrade() of a stock at 0 = %d %v, want %d", code, response, http.StatusBadRequest)
+	}
+	if code, response := closeTrade(t, "alice", "call-1", `{"closePrice": -1}`); code != http.StatusBadRequest || response["error"] != "ClosePrice must not be negative" {
+		t.Errorf("CloseTrade() of an option below 0 = %d %v, want %d", code, response, http.StatusBadRequest)
+	}
+	code, response := closeTrade(t, "alice", "call-1", `{"closePrice": 0, "closePositionAt": "2024-06-21T20:00:00Z"}`)
+	if code != http.StatusOK {
+		t.Fatalf("CloseTrade() of an option at 0 status = %d: %v", code, response)
+	}
+	if closed := response["closed"].(map[string]interface{}); closed["status"] != models.TradeStatusClosed || closed["realizedPnl"] != "-200" {
+		t.Errorf("closed = %v, want call-1 closed for -200", closed)
+	}
+}
+
+func TestTradePsychology(t *testing.T) {
+	useTestDB(t)
+	createTestTrade(t, "trade-1", "alice")
+
+	code, response := serveTrade(t, http.MethodPatch, "alice", "trade-1", `{"confidence": 4, "discipline": 2}`)
+	if code != http.StatusOK {
+		t.Fatalf("PATCH ratings status = %d: %v", code, response)
+	}
+	// Ratings left out of a PATCH keep their stored value
+	code, response = serveTrade(t, http.MethodPatch, "alice", "trade-1", `{"emotionAfter": 5}`)
+	if code != http.StatusOK {
+		t.Fatalf("PATCH status = %d: %v", code, response)
+	}
+	want := map[string]interface{}{"confidence": float64(4), "emotionBefore": nil, "emotionAfter": float64(5), "discipline": float64(2)}
+	if psychology := response["psychology"].(map[string]interface{}); !reflect.DeepEqual(psychology, want) {
+		t.Errorf("psychology = %v, want %v", psychology, want)
+	}
+
+	// The part closed out of the position was traded in the same state of mind
+	code, response = closeTrade(t, "alice", "trade-1", `{"closePrice": 110, "quantity": 4, "closePositionAt": "2024-03-05T15:00:00Z"}`)
+	if code != http.StatusOK {
+		t.Fatalf("CloseTrade() status = %d: %v", code, response)
+	}
+	if psychology := response["closed"].(map[string]interface{})["psychology"]; !reflect.DeepEqual(psychology, want) {
+		t.Errorf("closed psychology = %v, want %v", psychology, want)
+	}
+}
+
+func TestDeleteTradeDeletesDependents(t *testing.T) {
+	useTestDB(t)
+	createTestTrade(t, "trade-1", "alice")
+	createTestTrade(t, "trade-2", "alice")
+	createTestTrade(t, "trade-3", "alice")
+	// trade-2 was split off trade-1 by a partial close
+	if err := utils.DB.Model(&models.Trade{}).Where("trad_id = ?", "trade-2").Update("parent_trad_id", "trade-1").Error; err != nil {
+		t.Fatalf("linking the split trade: %v", err)
+	}
+	executedAt := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	dependents := []interface{}{
+		&models.Execution{ExecutionId: "execution-1", TradId: "trade-1", Side: models.ExecutionSideBuy, Quantity: decimal.NewFromInt(10), Price: decimal.NewFromInt(100), ExecutedAt: executedAt},
+		&models.Execution{ExecutionId: "execution-2", TradId: "trade-2", Side: models.ExecutionSideBuy, Quantity: decimal.NewFromInt(4), Price: decimal.NewFromInt(100), ExecutedAt: executedAt},
+		&models.Execution{ExecutionId: "execution-3", TradId: "trade-3", Side: models.ExecutionSideBuy, Quantity: decimal.NewFromInt(10), Price: decimal.NewFromInt(100), ExecutedAt: executedAt},
+		&models.Note{NoteId: "note-1", UserId: "alice", TradId: "trade-2", Body: "Took profit early"},
+		&models.Note{NoteId: "note-2", UserId: "alice", TradId: "trade-3", Body: "Chased the entry"},
+		&models.Attachment{AttachmentId: "attachment-1", UserId: "alice", TradId: "trade-2", ObjectKey: "users/alice/trades/trade-2/attachments/attachment-1.png"},
+		&models.Attachment{AttachmentId: "attachment-2", UserId: "alice", TradId: "trade-3", ObjectKey: "users/alice/trades/trade-3/attachments/attachment-2.png"},
+		&models.FundingPayment{PaymentId: "payment-1", UserId: "alice", TradId: "trade-1", Amount: decimal.NewFromInt(2), PaidAt: executedAt},
+		&models.FundingPayment{PaymentId: "payment-2", UserId: "alice", TradId: "trade-3", Amount: decimal.NewFromInt(3), PaidAt: executedAt},
+	}
+	store := useTestStorage(t)
+	store.Put(testBucket, "users/alice/trades/trade-2/attachments/attachment-1.png", utils.ObjectInfo{Size: 1024, ContentType: "image/png"})
+	store.Put(testBucket, "users/alice/trades/trade-3/attachments/attachment-2.png", utils.ObjectInfo{Size: 1024, ContentType: "image/png"})
+	for _, dependent := range dependents {
+		if err := utils.DB.Create(dependent).Error; err != nil {
+			t.Fatalf("creating %T: %v", dependent, err)
+		}
+	}
+
+	if code, response := serveTrade(t, http.MethodDelete, "bob", "trade-1", ""); code != http.StatusNotFound {
+		t.Fatalf("DELETE by another user status = %d, want %d: %v", code, http.StatusNotFound, response)
+	}
+	if code, response := serveTrade(t, http.MethodDelete, "alice", "trade-1", ""); code != http.StatusNoContent {
+		t.Fatalf("DELETE status = %d, want %d: %v", code, http.StatusNoContent, response)
+	}
+
+	tests := []struct {
+		model interface{}
+		left  int64
+	}{
+		{&models.Trade{}, 1},
+		{&models.Execution{}, 1},
+		{&models.Note{}, 1},
+		{&models.Attachment{}, 1},
+		{&models.FundingPayment{}, 1},
+	}
+	for _, tt := range tests {
+		var count int64
+		if err := utils.DB.Model(tt.model).Count(&count).Error; err != nil {
+			t.Fatalf("counting %T: %v", tt.model, err)
+		}
+		if count != tt.left {
+			t.Errorf("%d %T left, want %d", count, tt.model, tt.left)
+		}
+	}
+	if keys := store.Keys(testBucket); !reflect.DeepEqual(keys, []string{"users/alice/trades/trade-3/attachments/attachment-2.png"}) {
+		t.Errorf("stored files = %v, want only the one of trade-3", keys)
+	}
+	if _, err := findUserTrade("trade-3", "alice"); err != nil {
+		t.Errorf("unrelated trade was deleted: %v", err)
+	}
+}
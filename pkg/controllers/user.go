@@ -523,13 +523,22 @@ func GetProfile(w http.ResponseWriter, r *http.Request){
 		})
 		return
 	}
+	pictureURL, err := profilePictureURL(r, user)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "An error has occurred while fetching the profile picture",
+		})
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"email": user.Email,
 		"firstName": user.FirstName,
 		"lastName": user.LastName,
 		"fullName": user.FullName,
-		"profilePictureURL": user.ProfileUrl,
+		"timezone": user.Timezone,
+		"profilePictureURL": pictureURL,
 	})
 	return
 }
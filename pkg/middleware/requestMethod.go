@@ -10,7 +10,7 @@ func MethodCheckMiddleware(next http.Handler, allowedMethods []string) http.Hand
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
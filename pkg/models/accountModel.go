@@ -0,0 +1,27 @@
+package models
+
+import (
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	AccountTypeLive  = "live"
+	AccountTypePaper = "paper"
+	AccountTypeProp  = "prop"
+)
+
+// Account is a brokerage or trading account that owns trades
+type Account struct {
+	gorm.Model
+	AccountId string `gorm:"unique"`
+	UserId string `gorm:"index"`
+	Name string
+	Broker string
+	BaseCurrency string
+	StartingBalance decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	AccountType string `gorm:"not null;default:live"`
+	// Unassigned trades have an empty AccountId, which no account matches
+	Trades []Trade `gorm:"foreignKey:AccountId;references:AccountId;constraint:-"`
+	LedgerEntries []LedgerEntry `gorm:"foreignKey:AccountId;references:AccountId"`
+}
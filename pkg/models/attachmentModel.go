@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// AttachmentStatusPending attachments have an upload URL handed out but
+	// the upload has not been confirmed yet
+	AttachmentStatusPending  = "pending"
+	AttachmentStatusUploaded = "uploaded"
+)
+
+// Attachment is a file, typically a chart screenshot, uploaded for a trade.
+// The file itself lives in object storage under ObjectKey.
+type Attachment struct {
+	gorm.Model
+	AttachmentId string `gorm:"unique"`
+	UserId string `gorm:"index"`
+	TradId string `gorm:"index"`
+	ObjectKey string `gorm:"unique"`
+	FileName string
+	ContentType string
+	Size int64
+	Status string `gorm:"not null;default:pending"`
+	UploadedAt *time.Time
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	ExecutionSideBuy  = "buy"
+	ExecutionSideSell = "sell"
+)
+
+// Execution is a single fill of a trade. A trade with executions derives its
+// size, average entry and exit prices and P&L from them.
+type Execution struct {
+	gorm.Model
+	ExecutionId string `gorm:"unique"`
+	TradId string `gorm:"index"`
+	Side string
+	Quantity decimal.Decimal `gorm:"type:numeric(38,18)"`
+	Price decimal.Decimal `gorm:"type:numeric(38,18)"`
+	ExecutedAt time.Time
+	Fee decimal.Decimal `gorm:"type:numeric(38,18)"`
+}
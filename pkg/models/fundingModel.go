@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// FundingPayment is a funding payment exchanged on a perpetual futures
+// position. Amount is positive when it was paid and negative when it was
+// received, the same as Trade.Funding which it accrues to.
+type FundingPayment struct {
+	gorm.Model
+	PaymentId string `gorm:"unique"`
+	TradId string `gorm:"index"`
+	UserId string `gorm:"index"`
+	// Rate and MarkPrice are set when Amount was computed from them
+	Rate decimal.NullDecimal `gorm:"type:numeric(38,18)"`
+	MarkPrice decimal.NullDecimal `gorm:"type:numeric(38,18)"`
+	Amount decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	PaidAt time.Time `gorm:"index"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// FxRate is an entry of the local exchange rate table: the price of one
+// unit of BaseCurrency in QuoteCurrency on the day AsOf
+type FxRate struct {
+	gorm.Model
+	BaseCurrency string `gorm:"uniqueIndex:idx_fx_rate"`
+	QuoteCurrency string `gorm:"uniqueIndex:idx_fx_rate"`
+	AsOf time.Time `gorm:"type:date;uniqueIndex:idx_fx_rate"`
+	Rate decimal.Decimal `gorm:"type:numeric(38,18)"`
+}
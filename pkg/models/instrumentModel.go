@@ -0,0 +1,69 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	AssetClassStock     = "stock"
+	AssetClassETF       = "etf"
+	AssetClassForex     = "forex"
+	AssetClassCrypto    = "crypto"
+	AssetClassFuture    = "future"
+	AssetClassOption    = "option"
+	AssetClassIndex     = "index"
+	AssetClassCommodity = "commodity"
+)
+
+// Instrument is an entry of the shared instrument catalog. Trades refer to
+// an instrument through their Asset, which holds the instrument Symbol once
+// resolved.
+type Instrument struct {
+	gorm.Model
+	Symbol string `gorm:"unique"`
+	Name string
+	AssetClass string `gorm:"index"`
+	Exchange string
+	QuoteCurrency string
+	TickSize decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	// ContractMultiplier is the number of units of the underlying one
+	// contract or lot stands for, 1 for instruments traded in units
+	ContractMultiplier decimal.Decimal `gorm:"type:numeric(38,18);not null;default:1"`
+	// PipSize is only set for forex pairs and CFDs quoted in pips
+	PipSize decimal.NullDecimal `gorm:"type:numeric(38,18)"`
+	// ContractMonths are the month codes futures are listed for, such as
+	// HMUZ for quarterly contracts
+	ContractMonths string
+	Aliases []InstrumentAlias `gorm:"foreignKey:Symbol;references:Symbol"`
+}
+
+// FuturesMonthCodes are the futures delivery month codes, January to December
+const FuturesMonthCodes = "FGHJKMNQUVXZ"
+
+// TickValue is the money one tick is worth for a single contract
+func (i *Instrument) TickValue() decimal.Decimal {
+	return i.TickSize.Mul(i.ContractMultiplier)
+}
+
+// InstrumentAlias maps a normalized spelling of an instrument to its Symbol
+type InstrumentAlias struct {
+	gorm.Model
+	Alias string `gorm:"unique"`
+	Symbol string `gorm:"index"`
+}
+
+// NormalizeSymbol reduces the spellings of a symbol to one key, so that
+// "btc/usd", "BTC-USD" and "BTCUSD" all resolve to the same alias. Only
+// letters and digits are kept, upper cased.
+func NormalizeSymbol(symbol string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, symbol)
+}
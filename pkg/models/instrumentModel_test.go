@@ -0,0 +1,22 @@
+package models
+
+import "testing"
+
+func TestNormalizeSymbol(t *testing.T) {
+	tests := []struct {
+		symbol string
+		want   string
+	}{
+		{"BTCUSD", "BTCUSD"},
+		{"btc/usd", "BTCUSD"},
+		{"BTC-USD", "BTCUSD"},
+		{"NASDAQ:AAPL", "NASDAQAAPL"},
+		{" es1! ", "ES1"},
+		{"/-", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeSymbol(tt.symbol); got != tt.want {
+			t.Errorf("NormalizeSymbol(%q) = %q, want %q", tt.symbol, got, tt.want)
+		}
+	}
+}
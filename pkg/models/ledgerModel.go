@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	LedgerEntryDeposit    = "deposit"
+	LedgerEntryWithdrawal = "withdrawal"
+	LedgerEntryInterest   = "interest"
+	LedgerEntryDividend   = "dividend"
+	LedgerEntryAdjustment = "adjustment"
+)
+
+// LedgerIncomeTypes are the entries earned by the account. Every other entry
+// is an external flow, which is excluded from time-weighted returns.
+var LedgerIncomeTypes = []string{LedgerEntryInterest, LedgerEntryDividend}
+
+// LedgerEntry is a cash movement on an account. Amount is signed: money
+// coming into the account is positive and money leaving it is negative.
+type LedgerEntry struct {
+	gorm.Model
+	EntryId string `gorm:"unique"`
+	AccountId string `gorm:"index"`
+	UserId string `gorm:"index"`
+	EntryType string
+	Amount decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	OccurredAt time.Time `gorm:"index"`
+	Note string
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Note is a Markdown journal entry attached either to a trade or to a
+// calendar day of the user
+type Note struct {
+	gorm.Model
+	NoteId string `gorm:"unique"`
+	UserId string `gorm:"index"`
+	// TradId is set for trade notes, Day for day notes
+	TradId string `gorm:"index"`
+	Day *time.Time `gorm:"type:date;index"`
+	Body string
+	Revisions []NoteRevision `gorm:"foreignKey:NoteId;references:NoteId"`
+}
+
+// NoteRevision keeps a previous body of a note each time it is edited
+type NoteRevision struct {
+	gorm.Model
+	NoteId string `gorm:"index"`
+	Body string
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	OptionStrategySingle     = "single"
+	OptionStrategyVertical   = "vertical"
+	OptionStrategyIronCondor = "iron_condor"
+	OptionStrategyButterfly  = "butterfly"
+	OptionStrategyStraddle   = "straddle"
+	OptionStrategyStrangle   = "strangle"
+	OptionStrategyCalendar   = "calendar"
+	OptionStrategyDiagonal   = "diagonal"
+	OptionStrategyCovered    = "covered"
+	OptionStrategyCustom     = "custom"
+)
+
+// OptionStrategyTypes are the accepted values of OptionStrategy.StrategyType
+var OptionStrategyTypes = []string{
+	OptionStrategySingle, OptionStrategyVertical, OptionStrategyIronCondor, OptionStrategyButterfly,
+	OptionStrategyStraddle, OptionStrategyStrangle, OptionStrategyCalendar, OptionStrategyDiagonal,
+	OptionStrategyCovered, OptionStrategyCustom,
+}
+
+// OptionStrategy groups the trades making up a multi-leg option position,
+// such as the four legs of an iron condor. Legs without an option contract
+// are positions in the underlying, as in a covered call.
+type OptionStrategy struct {
+	gorm.Model
+	StrategyId string `gorm:"unique"`
+	UserId string `gorm:"index"`
+	Name string
+	StrategyType string `gorm:"not null;default:custom"`
+	Underlying string
+	// Trades outside a strategy have an empty OptionStrategyId, which no
+	// strategy matches
+	Legs []Trade `gorm:"foreignKey:OptionStrategyId;references:StrategyId;constraint:-"`
+}
+
+// NetPremium is what was paid to open all legs, negative when the position
+// was opened for a credit
+func (s *OptionStrategy) NetPremium() decimal.Decimal {
+	premium := decimal.Zero
+	for _, leg := range s.Legs {
+		premium = premium.Add(leg.DirectionSign().Mul(leg.Quantity).Mul(leg.ContractMultiplier()).Mul(leg.OpenPrice))
+	}
+	return premium.Round(MoneyScale)
+}
+
+// RiskProfile returns the most the position can lose and the most it can
+// make when held to expiration, before costs. Either is invalid when it is
+// unlimited, such as the loss of a naked short call.
+//
+// When all options share an expiry the payoff is linear between strikes, so
+// the extremes are found at a price of zero, at the strikes or as the price
+// goes to infinity. Legs expiring at different dates (calendars, diagonals)
+// depend on the value left in the later options, which is unknown, so only
+// the net debit is reported as the risk and the profit is left invalid.
+func (s *OptionStrategy) RiskProfile() (maxRisk decimal.NullDecimal, maxProfit decimal.NullDecimal) {
+	if len(s.Legs) == 0 {
+		return
+	}
+
+	var expiry string
+	prices := []decimal.Decimal{decimal.Zero}
+	for _, leg := range s.Legs {
+		if !leg.IsOption() {
+			continue
+		}
+		if leg.Expiry != nil {
+			legExpiry := leg.Expiry.Format(time.DateOnly)
+			if expiry != "" && legExpiry != expiry {
+				if premium := s.NetPremium(); premium.IsPositive() {
+					maxRisk = decimal.NewNullDecimal(premium)
+				}
+				return
+			}
+			expiry = legExpiry
+		}
+		if leg.Strike.Valid {
+			prices = append(prices, leg.Strike.Decimal)
+		}
+	}
+
+	payoff := func(price decimal.Decimal) decimal.Decimal {
+		total := decimal.Zero
+		for _, leg := range s.Legs {
+			value := price
+			if leg.OptionType == OptionTypeCall {
+				value = decimal.Max(price.Sub(leg.Strike.Decimal), decimal.Zero)
+			} else if leg.OptionType == OptionTypePut {
+				value = decimal.Max(leg.Strike.Decimal.Sub(price), decimal.Zero)
+			}
+			units := leg.DirectionSign().Mul(leg.Quantity).Mul(leg.ContractMultiplier())
+			total = total.Add(units.Mul(value.Sub(leg.OpenPrice)))
+		}
+		return total
+	}
+	// Above the highest strike puts are worthless, calls and the underlying
+	// move one for one with the price
+	slope := decimal.Zero
+	for _, leg := range s.Legs {
+		if leg.OptionType != OptionTypePut {
+			slope = slope.Add(leg.DirectionSign().Mul(leg.Quantity).Mul(leg.ContractMultiplier()))
+		}
+	}
+
+	lowest, highest := payoff(prices[0]), payoff(prices[0])
+	for _, price := range prices[1:] {
+		value := payoff(price)
+		lowest = decimal.Min(lowest, value)
+		highest = decimal.Max(highest, value)
+	}
+	if slope.Sign() >= 0 {
+		maxRisk = decimal.NewNullDecimal(decimal.Max(lowest.Neg(), decimal.Zero).Round(MoneyScale))
+	}
+	if slope.Sign() <= 0 {
+		maxProfit = decimal.NewNullDecimal(highest.Round(MoneyScale))
+	}
+	return
+}
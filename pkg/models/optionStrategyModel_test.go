@@ -0,0 +1,100 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// optionLeg builds a leg of one contract on 100 shares of the underlying
+func optionLeg(direction string, optionType string, strike string, premium string, expiry time.Time) Trade {
+	return Trade{
+		Direction:      direction,
+		Quantity:       dec("1"),
+		OpenPrice:      dec(premium),
+		Multiplier:     dec("100"),
+		OptionContract: OptionContract{OptionType: optionType, Underlying: "XYZ", Strike: nullDec(strike), Expiry: &expiry},
+	}
+}
+
+func TestRiskProfile(t *testing.T) {
+	expiry := time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)
+	later := expiry.AddDate(0, 1, 0)
+	long, short := TradeDirectionLong, TradeDirectionShort
+	tests := []struct {
+		name      string
+		legs      []Trade
+		maxRisk   string
+		maxProfit string
+	}{
+		{"no legs", nil, "", ""},
+		{
+			"long call",
+			[]Trade{optionLeg(long, OptionTypeCall, "100", "2", expiry)},
+			"200", "",
+		},
+		{
+			"naked short call",
+			[]Trade{optionLeg(short, OptionTypeCall, "100", "2", expiry)},
+			"", "200",
+		},
+		{
+			"long put",
+			[]Trade{optionLeg(long, OptionTypePut, "100", "3", expiry)},
+			"300", "9700",
+		},
+		{
+			"bull call vertical",
+			[]Trade{
+				optionLeg(long, OptionTypeCall, "100", "5", expiry),
+				optionLeg(short, OptionTypeCall, "110", "2", expiry),
+			},
+			"300", "700",
+		},
+		{
+			"iron condor",
+			[]Trade{
+				optionLeg(long, OptionTypePut, "90", "1", expiry),
+				optionLeg(short, OptionTypePut, "95", "2", expiry),
+				optionLeg(short, OptionTypeCall, "105", "2", expiry),
+				optionLeg(long, OptionTypeCall, "110", "1", expiry),
+			},
+			"300", "200",
+		},
+		{
+			"covered call",
+			[]Trade{
+				{Direction: long, Quantity: dec("100"), OpenPrice: dec("50"), Asset: "XYZ"},
+				optionLeg(short, OptionTypeCall, "55", "1", expiry),
+			},
+			"4900", "600",
+		},
+		{
+			"calendar spread for a debit",
+			[]Trade{
+				optionLeg(short, OptionTypeCall, "100", "3", expiry),
+				optionLeg(long, OptionTypeCall, "100", "5", later),
+			},
+			"200", "",
+		},
+		{
+			"diagonal spread for a credit",
+			[]Trade{
+				optionLeg(short, OptionTypePut, "100", "6", expiry),
+				optionLeg(long, OptionTypePut, "95", "2", later),
+			},
+			"", "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy := &OptionStrategy{Legs: tt.legs}
+			maxRisk, maxProfit := strategy.RiskProfile()
+			if !equalNull(maxRisk, tt.maxRisk) {
+				t.Errorf("maxRisk = %v, want %q", maxRisk, tt.maxRisk)
+			}
+			if !equalNull(maxProfit, tt.maxProfit) {
+				t.Errorf("maxProfit = %v, want %q", maxProfit, tt.maxProfit)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// SchemaMigration records a one-off data migration that has been applied,
+// so it never runs again
+type SchemaMigration struct {
+	Version string `gorm:"primaryKey"`
+	AppliedAt time.Time
+}
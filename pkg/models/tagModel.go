@@ -0,0 +1,20 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	TagKindTag      = "tag"
+	TagKindStrategy = "strategy"
+	TagKindMistake  = "mistake"
+)
+
+// Tag is a user-owned label attached to trades, such as a setup, a strategy
+// or a mistake made in the trade. Kind tells them apart.
+type Tag struct {
+	gorm.Model
+	TagId string `gorm:"unique"`
+	UserId string `gorm:"index"`
+	Kind string `gorm:"not null;default:tag;index"`
+	Name string
+	Description string
+}
@@ -1,20 +1,419 @@
 package models
 
 import (
+	"errors"
+	"sort"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
+// MoneyScale is the number of decimal places stored for prices, sizes and
+// money amounts, enough for crypto prices quoted in satoshis or wei fractions
+const MoneyScale = 18
+
+// PercentScale is the number of decimal places kept for percentages
+const PercentScale = 8
+
+const (
+	TradeStatusOpen   = "open"
+	TradeStatusClosed = "closed"
+)
+
+const (
+	TradeDirectionLong  = "long"
+	TradeDirectionShort = "short"
+)
+
+const (
+	OptionTypeCall = "call"
+	OptionTypePut  = "put"
+)
+
+const (
+	// OptionExpired options expired worthless
+	OptionExpired = "expired"
+	// OptionAssigned short options were assigned and OptionExercised long
+	// options were exercised, both turning into a position in the underlying
+	OptionAssigned  = "assigned"
+	OptionExercised = "exercised"
+)
+
+const (
+	MarginModeIsolated = "isolated"
+	MarginModeCross    = "cross"
+)
+
+// DefaultMaintenanceMarginRate is the share of the position value that must
+// stay in the margin, used when a leveraged trade does not set its own
+var DefaultMaintenanceMarginRate = decimal.RequireFromString("0.005")
+
+const (
+	LotSizeStandard = "standard"
+	LotSizeMini     = "mini"
+	LotSizeMicro    = "micro"
+)
+
+// LotSizeFractions are the parts of a standard lot each lot size stands for
+var LotSizeFractions = map[string]decimal.Decimal{
+	LotSizeStandard: decimal.NewFromInt(1),
+	LotSizeMini:     decimal.RequireFromString("0.1"),
+	LotSizeMicro:    decimal.RequireFromString("0.01"),
+}
+
+// Psychology ratings range from RatingMin to RatingMax, higher is better
+const (
+	RatingMin = 1
+	RatingMax = 5
+)
+
+// DefaultOptionMultiplier is the number of shares an equity option contract
+// is for
+const DefaultOptionMultiplier = 100
+
+// OptionContract holds the contract of an option trade. It is empty for
+// trades in anything other than options.
+type OptionContract struct {
+	OptionType string
+	Underlying string `gorm:"index"`
+	Strike decimal.NullDecimal `gorm:"type:numeric(38,18)"`
+	Expiry *time.Time `gorm:"type:date"`
+	// ExpirationOutcome records how an option held until it ended was settled
+	ExpirationOutcome string
+}
+
+// FuturesContract identifies the contract of a futures trade. It is empty
+// for trades in anything other than futures.
+type FuturesContract struct {
+	RootSymbol string `gorm:"index"`
+	// ContractMonth is the delivery month formatted as 2006-01, empty for
+	// trades logged against the root symbol
+	ContractMonth string
+	// RolledFromTradId points at the position in the previous contract month
+	// this one was rolled from
+	RolledFromTradId string `gorm:"index"`
+}
+
+// ForexPosition holds the pip quoting of a forex trade, or of any other
+// instrument quoted in pips. It is empty for trades in anything else.
+type ForexPosition struct {
+	// LotSize is the lot Quantity is counted in, empty when it is in units
+	LotSize string
+	PipSize decimal.NullDecimal `gorm:"type:numeric(38,18)"`
+	// ConversionRate is the value of one unit of the quote currency in the
+	// currency of the account, 1 when they are the same
+	ConversionRate decimal.Decimal `gorm:"type:numeric(38,18);not null;default:1"`
+	// Pips is the price move captured by the trade, in pips
+	Pips decimal.NullDecimal `gorm:"type:numeric(38,18)"`
+}
+
+// TradePsychology holds how the trader rated their state of mind around a
+// trade. Every rating is optional.
+type TradePsychology struct {
+	Confidence *int `gorm:"type:smallint"`
+	// EmotionBefore and EmotionAfter rate the emotional state on entering
+	// and leaving the trade, from distressed to calm
+	EmotionBefore *int `gorm:"type:smallint"`
+	EmotionAfter *int `gorm:"type:smallint"`
+	// Discipline rates how closely the trade plan was followed
+	Discipline *int `gorm:"type:smallint"`
+}
 
 type Trade struct {
 	gorm.Model
-	TradId string `gorm:"primaryKey;column:trad_id"`
+	// TradId is unique on its own so other tables can reference it
+	TradId string `gorm:"primaryKey;uniqueIndex;column:trad_id"`
 	UserId string
+	// AccountId is the account the trade was placed in, empty when unassigned
+	AccountId string `gorm:"index"`
+	// ParentTradId points at the open position a partial close was split from
+	ParentTradId string `gorm:"index"`
 	Asset string
+	OptionContract `gorm:"embedded"`
+	FuturesContract `gorm:"embedded"`
+	ForexPosition `gorm:"embedded"`
+	TradePsychology `gorm:"embedded"`
+	// OptionStrategyId groups the legs of a multi-leg option position
+	OptionStrategyId string `gorm:"index"`
+	Status string `gorm:"not null;default:closed;index"`
+	Direction string `gorm:"not null;default:long"`
+	Quantity decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	// ExitedQuantity is the part of Quantity that has been closed out
+	ExitedQuantity decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	// Multiplier is the number of units of the underlying one unit of
+	// Quantity stands for, such as the 100 shares of an equity option
+	Multiplier decimal.Decimal `gorm:"type:numeric(38,18);not null;default:1"`
 	OpenPositionAt time.Time
-	ClosePositionAt time.Time
-	Margin float32
-	OpenPrice float32
-	ClosePrice float32
+	ClosePositionAt *time.Time
+	Margin decimal.Decimal `gorm:"type:numeric(38,18)"`
+	// Leverage of a margined position such as a crypto perpetual, invalid for
+	// unleveraged trades. MarginMode is isolated or cross when it is set.
+	Leverage decimal.NullDecimal `gorm:"type:numeric(38,18)"`
+	MarginMode string
+	MaintenanceMarginRate decimal.NullDecimal `gorm:"type:numeric(38,18)"`
+	// LiquidationPrice is where the margin of a leveraged position runs out
+	LiquidationPrice decimal.NullDecimal `gorm:"type:numeric(38,18)"`
+	OpenPrice decimal.Decimal `gorm:"type:numeric(38,18)"`
+	ClosePrice decimal.Decimal `gorm:"type:numeric(38,18)"`
+	// RealizedPnl is the gross profit or loss of a closed trade
+	RealizedPnl decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	// ReturnPct is the price move captured by the trade, in percent
+	ReturnPct decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	// ReturnOnMargin is RealizedPnl relative to Margin, in percent
+	ReturnOnMargin decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	// Costs of the trade. Commission and Fees are always paid, Swap and
+	// Funding are positive when paid and negative when received.
+	Commission decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	Fees decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	Swap decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	Funding decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	// ExecutionFees is the sum of the fees of the executions, paid on top of
+	// the Commission set on the trade
+	ExecutionFees decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	// NetPnl is RealizedPnl after all costs
+	NetPnl decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	NetReturnPct decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	NetReturnOnMargin decimal.Decimal `gorm:"type:numeric(38,18);not null;default:0"`
+	// Trade plan. PlannedRisk is the money at risk, when it is not set the
+	// risk is derived from the distance between entry and StopLoss.
+	StopLoss decimal.NullDecimal `gorm:"type:numeric(38,18)"`
+	TakeProfit decimal.NullDecimal `gorm:"type:numeric(38,18)"`
+	PlannedRisk decimal.NullDecimal `gorm:"type:numeric(38,18)"`
+	// InitialRisk is the money at risk used as 1R
+	InitialRisk decimal.NullDecimal `gorm:"type:numeric(38,18)"`
+	// PlannedRewardRisk is the reward to risk ratio of TakeProfit against StopLoss
+	PlannedRewardRisk decimal.NullDecimal `gorm:"type:numeric(38,18)"`
+	// RMultiple is NetPnl expressed in multiples of InitialRisk
+	RMultiple decimal.NullDecimal `gorm:"type:numeric(38,18);index"`
+	Executions []Execution `gorm:"foreignKey:TradId;references:TradId"`
+	Attachments []Attachment `gorm:"foreignKey:TradId;references:TradId"`
+	FundingPayments []FundingPayment `gorm:"foreignKey:TradId;references:TradId"`
+	Tags []Tag `gorm:"many2many:trade_tags;foreignKey:TradId;joinForeignKey:TradId;references:TagId;joinReferences:TagId"`
+}
+
+// ErrExecutionOverfill is returned when exits exceed the position size
+var ErrExecutionOverfill = errors.New("executions close more than the open position")
+
+// IsOpen reports whether the position has not been closed yet
+func (t *Trade) IsOpen() bool {
+	return t.Status == TradeStatusOpen
+}
+
+// DirectionSign is 1 for long trades and -1 for short trades
+func (t *Trade) DirectionSign() decimal.Decimal {
+	if t.Direction == TradeDirectionShort {
+		return decimal.NewFromInt(-1)
+	}
+	return decimal.NewFromInt(1)
+}
+
+// EntrySide is the execution side that adds to the position
+func (t *Trade) EntrySide() string {
+	if t.Direction == TradeDirectionShort {
+		return ExecutionSideSell
+	}
+	return ExecutionSideBuy
+}
+
+// IsOption reports whether the trade is in an option contract
+func (t *Trade) IsOption() bool {
+	return t.OptionType != ""
+}
+
+// IsFuture reports whether the trade is in a futures contract
+func (t *Trade) IsFuture() bool {
+	return t.RootSymbol != ""
+}
+
+// ContractMultiplier is the Multiplier of the trade, treating an unset one as 1
+func (t *Trade) ContractMultiplier() decimal.Decimal {
+	if t.Multiplier.IsPositive() {
+		return t.Multiplier
+	}
+	return decimal.NewFromInt(1)
+}
+
+// IsLeveraged reports whether the trade is a leveraged margin position
+func (t *Trade) IsLeveraged() bool {
+	return t.Leverage.Valid
+}
+
+// LiquidationPriceFor returns the price at which the collateral backing the
+// position, plus its unrealized P&L, falls to the maintenance margin. It is
+// invalid when the position cannot be liquidated, such as a long backed by
+// more than its full value.
+func (t *Trade) LiquidationPriceFor(collateral decimal.Decimal) decimal.NullDecimal {
+	units := t.Quantity.Mul(t.ContractMultiplier())
+	if !t.IsLeveraged() || units.IsZero() {
+		return decimal.NullDecimal{}
+	}
+	rate := DefaultMaintenanceMarginRate
+	if t.MaintenanceMarginRate.Valid {
+		rate = t.MaintenanceMarginRate.Decimal
+	}
+
+	// Long: collateral + units * (price - entry) = rate * units * price
+	// Short: collateral + units * (entry - price) = rate * units * price
+	one := decimal.NewFromInt(1)
+	entryValue := t.OpenPrice.Mul(units)
+	var price decimal.Decimal
+	if t.Direction == TradeDirectionShort {
+		price = entryValue.Add(collateral).Div(units.Mul(one.Add(rate)))
+	} else {
+		price = entryValue.Sub(collateral).Div(units.Mul(one.Sub(rate)))
+	}
+	if !price.IsPositive() {
+		return decimal.NullDecimal{}
+	}
+	return decimal.NewNullDecimal(price.Round(MoneyScale))
+}
+
+// QuoteConversion is the ConversionRate of the trade, treating an unset one as 1
+func (t *Trade) QuoteConversion() decimal.Decimal {
+	if t.ConversionRate.IsPositive() {
+		return t.ConversionRate
+	}
+	return decimal.NewFromInt(1)
+}
+
+// PipValue is the money a move of one pip is worth for the whole position,
+// in the currency of the account. It is invalid for trades not quoted in pips.
+func (t *Trade) PipValue() decimal.NullDecimal {
+	if !t.PipSize.Valid {
+		return decimal.NullDecimal{}
+	}
+	value := t.PipSize.Decimal.Mul(t.Quantity).Mul(t.ContractMultiplier()).Mul(t.QuoteConversion())
+	return decimal.NewNullDecimal(value.Round(MoneyScale))
+}
+
+// TotalCosts is the sum of commission, fees, swap, funding and execution fees
+func (t *Trade) TotalCosts() decimal.Decimal {
+	return t.Commission.Add(t.Fees).Add(t.Swap).Add(t.Funding).Add(t.ExecutionFees)
+}
+
+// ComputePnl updates the gross RealizedPnl, ReturnPct and ReturnOnMargin
+// from the average entry and exit prices over the exited quantity, and their
+// net counterparts after TotalCosts. Positions with nothing closed out have
+// no realized figures. Money amounts are converted from the quote currency
+// with QuoteConversion, and trades quoted in pips also get their Pips.
+func (t *Trade) ComputePnl() {
+	t.RealizedPnl = decimal.Zero
+	t.ReturnPct = decimal.Zero
+	t.ReturnOnMargin = decimal.Zero
+	t.NetPnl = decimal.Zero
+	t.NetReturnPct = decimal.Zero
+	t.NetReturnOnMargin = decimal.Zero
+	t.Pips = decimal.NullDecimal{}
+	t.computeRisk()
+	t.computeLiquidation()
+	if t.ExitedQuantity.IsZero() || t.OpenPrice.IsZero() {
+		return
+	}
+
+	exitedUnits := t.ExitedQuantity.Mul(t.ContractMultiplier())
+	move := t.DirectionSign().Mul(t.ClosePrice.Sub(t.OpenPrice))
+	t.RealizedPnl = move.Mul(exitedUnits).Mul(t.QuoteConversion()).Round(MoneyScale)
+	t.ReturnPct = move.Div(t.OpenPrice).Shift(2).Round(PercentScale)
+	t.NetPnl = t.RealizedPnl.Sub(t.TotalCosts())
+	// The net return is measured against the value that was closed out
+	t.NetReturnPct = t.NetPnl.Div(t.OpenPrice.Mul(exitedUnits).Mul(t.QuoteConversion())).Shift(2).Round(PercentScale)
+	if t.PipSize.Valid && t.PipSize.Decimal.IsPositive() {
+		t.Pips = decimal.NewNullDecimal(move.Div(t.PipSize.Decimal).Round(PercentScale))
+	}
+	if !t.Margin.IsZero() {
+		t.ReturnOnMargin = t.RealizedPnl.Div(t.Margin).Shift(2).Round(PercentScale)
+		t.NetReturnOnMargin = t.NetPnl.Div(t.Margin).Shift(2).Round(PercentScale)
+	}
+	if t.InitialRisk.Valid {
+		t.RMultiple = decimal.NewNullDecimal(t.NetPnl.Div(t.InitialRisk.Decimal).Round(PercentScale))
+	}
+}
+
+// computeRisk updates InitialRisk and PlannedRewardRisk from the trade plan
+// and resets RMultiple, which ComputePnl sets again once the trade has exits
+func (t *Trade) computeRisk() {
+	t.InitialRisk = decimal.NullDecimal{}
+	t.PlannedRewardRisk = decimal.NullDecimal{}
+	t.RMultiple = decimal.NullDecimal{}
+
+	var stopDistance decimal.Decimal
+	if t.StopLoss.Valid {
+		stopDistance = t.OpenPrice.Sub(t.StopLoss.Decimal).Abs()
+	}
+	if t.PlannedRisk.Valid && t.PlannedRisk.Decimal.IsPositive() {
+		t.InitialRisk = t.PlannedRisk
+	} else if stopDistance.IsPositive() && t.Quantity.IsPositive() {
+		t.InitialRisk = decimal.NewNullDecimal(stopDistance.Mul(t.Quantity).Mul(t.ContractMultiplier()).Mul(t.QuoteConversion()).Round(MoneyScale))
+	}
+	if t.TakeProfit.Valid && stopDistance.IsPositive() {
+		rewardDistance := t.TakeProfit.Decimal.Sub(t.OpenPrice).Abs()
+		t.PlannedRewardRisk = decimal.NewNullDecimal(rewardDistance.Div(stopDistance).Round(PercentScale))
+	}
+}
+
+// computeLiquidation updates LiquidationPrice of isolated positions, which
+// only have their own margin as collateral. Cross margin positions are
+// backed by the balance of their account, so LiquidationPrice is kept as it
+// was last computed against it.
+func (t *Trade) computeLiquidation() {
+	if !t.IsLeveraged() {
+		t.LiquidationPrice = decimal.NullDecimal{}
+		return
+	}
+	if t.MarginMode != MarginModeCross {
+		t.LiquidationPrice = t.LiquidationPriceFor(t.Margin)
+	}
+}
+
+// ApplyExecutions derives the size, average entry and exit prices, status,
+// open and close times, execution fees and P&L of the trade from its
+// executions. The trade is closed once the exits add up to the entries.
+func (t *Trade) ApplyExecutions() error {
+	if len(t.Executions) == 0 {
+		return nil
+	}
+	sort.SliceStable(t.Executions, func(i, j int) bool {
+		return t.Executions[i].ExecutedAt.Before(t.Executions[j].ExecutedAt)
+	})
+
+	var entryQuantity, entryValue, exitQuantity, exitValue, fees decimal.Decimal
+	var lastExitAt time.Time
+	for _, execution := range t.Executions {
+		fees = fees.Add(execution.Fee)
+		if execution.Side == t.EntrySide() {
+			entryQuantity = entryQuantity.Add(execution.Quantity)
+			entryValue = entryValue.Add(execution.Quantity.Mul(execution.Price))
+			continue
+		}
+		exitQuantity = exitQuantity.Add(execution.Quantity)
+		exitValue = exitValue.Add(execution.Quantity.Mul(execution.Price))
+		lastExitAt = execution.ExecutedAt
+		// The position can never go below zero at any point in time
+		if exitQuantity.GreaterThan(entryQuantity) {
+			return ErrExecutionOverfill
+		}
+	}
+
+	t.OpenPositionAt = t.Executions[0].ExecutedAt
+	t.Quantity = entryQuantity
+	t.ExitedQuantity = exitQuantity
+	t.ExecutionFees = fees
+	t.OpenPrice = decimal.Zero
+	if !entryQuantity.IsZero() {
+		t.OpenPrice = entryValue.Div(entryQuantity).Round(MoneyScale)
+	}
+	t.ClosePrice = decimal.Zero
+	if !exitQuantity.IsZero() {
+		t.ClosePrice = exitValue.Div(exitQuantity).Round(MoneyScale)
+	}
+	if !entryQuantity.IsZero() && exitQuantity.Equal(entryQuantity) {
+		t.Status = TradeStatusClosed
+		t.ClosePositionAt = &lastExitAt
+	} else {
+		t.Status = TradeStatusOpen
+		t.ClosePositionAt = nil
+	}
+	t.ComputePnl()
+	return nil
 }
@@ -0,0 +1,335 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// dec parses a decimal literal of a test case
+func dec(value string) decimal.Decimal {
+	return decimal.RequireFromString(value)
+}
+
+func TestApplyExecutionsKeepsCommission(t *testing.T) {
+	openAt := time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		commission    string
+		fees          []string
+		executionFees string
+		netPnl        string
+	}{
+		{"fills without fees", "5", []string{"0", "0"}, "0", "95"},
+		{"fills with fees", "5", []string{"1.5", "2"}, "3.5", "91.5"},
+		{"no commission", "0", []string{"1", "1"}, "2", "98"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trade := &Trade{
+				Direction:  TradeDirectionLong,
+				Commission: dec(tt.commission),
+				Executions: []Execution{
+					{Side: ExecutionSideBuy, Quantity: dec("10"), Price: dec("100"), ExecutedAt: openAt, Fee: dec(tt.fees[0])},
+					{Side: ExecutionSideSell, Quantity: dec("10"), Price: dec("110"), ExecutedAt: openAt.Add(time.Hour), Fee: dec(tt.fees[1])},
+				},
+			}
+			if err := trade.ApplyExecutions(); err != nil {
+				t.Fatalf("ApplyExecutions() error = %v", err)
+			}
+			if !trade.Commission.Equal(dec(tt.commission)) {
+				t.Errorf("Commission = %s, want %s", trade.Commission, tt.commission)
+			}
+			if !trade.ExecutionFees.Equal(dec(tt.executionFees)) {
+				t.Errorf("ExecutionFees = %s, want %s", trade.ExecutionFees, tt.executionFees)
+			}
+			if !trade.NetPnl.Equal(dec(tt.netPnl)) {
+				t.Errorf("NetPnl = %s, want %s", trade.NetPnl, tt.netPnl)
+			}
+		})
+	}
+}
+
+func TestApplyExecutionsCommissionSurvivesRecompute(t *testing.T) {
+	openAt := time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC)
+	trade := &Trade{
+		Direction: TradeDirectionShort,
+		Executions: []Execution{
+			{Side: ExecutionSideSell, Quantity: dec("2"), Price: dec("50"), ExecutedAt: openAt, Fee: dec("1")},
+		},
+	}
+	if err := trade.ApplyExecutions(); err != nil {
+		t.Fatalf("ApplyExecutions() error = %v", err)
+	}
+
+	// A commission edited later is kept when the next fill comes in
+	trade.Commission = dec("4")
+	trade.Executions = append(trade.Executions, Execution{Side: ExecutionSideBuy, Quantity: dec("2"), Price: dec("40"), ExecutedAt: openAt.Add(time.Hour), Fee: dec("1")})
+	if err := trade.ApplyExecutions(); err != nil {
+		t.Fatalf("ApplyExecutions() error = %v", err)
+	}
+	if !trade.Commission.Equal(dec("4")) {
+		t.Errorf("Commission = %s, want 4", trade.Commission)
+	}
+	if !trade.TotalCosts().Equal(dec("6")) {
+		t.Errorf("TotalCosts() = %s, want 6", trade.TotalCosts())
+	}
+	if !trade.NetPnl.Equal(dec("14")) {
+		t.Errorf("NetPnl = %s, want 14", trade.NetPnl)
+	}
+}
+
+// nullDec parses an optional decimal literal of a test case, invalid when
+// empty
+func nullDec(value string) decimal.NullDecimal {
+	if value == "" {
+		return decimal.NullDecimal{}
+	}
+	return decimal.NewNullDecimal(dec(value))
+}
+
+// equalNull reports whether an optional decimal matches the literal of a
+// test case
+func equalNull(got decimal.NullDecimal, want string) bool {
+	if want == "" {
+		return !got.Valid
+	}
+	return got.Valid && got.Decimal.Equal(dec(want))
+}
+
+func TestComputePnl(t *testing.T) {
+	type want struct {
+		realizedPnl, returnPct, netPnl, netReturnPct string
+		returnOnMargin, netReturnOnMargin            string
+		pips, rMultiple                              string
+	}
+	tests := []struct {
+		name  string
+		trade Trade
+		want  want
+	}{
+		{
+			"closed long",
+			Trade{Direction: TradeDirectionLong, Quantity: dec("10"), ExitedQuantity: dec("10"), OpenPrice: dec("100"), ClosePrice: dec("110"), Commission: dec("5")},
+			want{realizedPnl: "100", returnPct: "10", netPnl: "95", netReturnPct: "9.5", returnOnMargin: "0", netReturnOnMargin: "0"},
+		},
+		{
+			"closed short",
+			Trade{Direction: TradeDirectionShort, Quantity: dec("10"), ExitedQuantity: dec("10"), OpenPrice: dec("100"), ClosePrice: dec("90"), Fees: dec("2")},
+			want{realizedPnl: "100", returnPct: "10", netPnl: "98", netReturnPct: "9.8", returnOnMargin: "0", netReturnOnMargin: "0"},
+		},
+		{
+			"losing short",
+			Trade{Direction: TradeDirectionShort, Quantity: dec("4"), ExitedQuantity: dec("4"), OpenPrice: dec("50"), ClosePrice: dec("55"), Swap: dec("1"), Funding: dec("-0.5")},
+			want{realizedPnl: "-20", returnPct: "-10", netPnl: "-20.5", netReturnPct: "-10.25", returnOnMargin: "0", netReturnOnMargin: "0"},
+		},
+		{
+			"costs of the executions",
+			Trade{Direction: TradeDirectionLong, Quantity: dec("10"), ExitedQuantity: dec("10"), OpenPrice: dec("100"), ClosePrice: dec("110"), Commission: dec("5"), ExecutionFees: dec("3")},
+			want{realizedPnl: "100", returnPct: "10", netPnl: "92", netReturnPct: "9.2", returnOnMargin: "0", netReturnOnMargin: "0"},
+		},
+		{
+			"partially closed",
+			Trade{Direction: TradeDirectionLong, Quantity: dec("10"), ExitedQuantity: dec("4"), OpenPrice: dec("100"), ClosePrice: dec("105")},
+			want{realizedPnl: "20", returnPct: "5", netPnl: "20", netReturnPct: "5", returnOnMargin: "0", netReturnOnMargin: "0"},
+		},
+		{
+			"nothing closed",
+			Trade{Direction: TradeDirectionLong, Quantity: dec("10"), OpenPrice: dec("100"), Commission: dec("5")},
+			want{realizedPnl: "0", returnPct: "0", netPnl: "0", netReturnPct: "0", returnOnMargin: "0", netReturnOnMargin: "0"},
+		},
+		{
+			"futures point value",
+			Trade{Direction: TradeDirectionLong, Quantity: dec("2"), ExitedQuantity: dec("2"), OpenPrice: dec("4000"), ClosePrice: dec("4010"), Multiplier: dec("50"), Commission: dec("4.5")},
+			want{realizedPnl: "1000", returnPct: "0.25", netPnl: "995.5", netReturnPct: "0.248875", returnOnMargin: "0", netReturnOnMargin: "0"},
+		},
+		{
+			"forex converted to the account currency",
+			Trade{
+				Direction: TradeDirectionLong, Quantity: dec("1"), ExitedQuantity: dec("1"), OpenPrice: dec("1.1"), ClosePrice: dec("1.105"), Multiplier: dec("100000"),
+				ForexPosition: ForexPosition{PipSize: nullDec("0.0001"), ConversionRate: dec("0.9")},
+			},
+			want{realizedPnl: "450", returnPct: "0.45454545", netPnl: "450", netReturnPct: "0.45454545", returnOnMargin: "0", netReturnOnMargin: "0", pips: "50"},
+		},
+		{
+			"return on margin",
+			Trade{Direction: TradeDirectionLong, Quantity: dec("10"), ExitedQuantity: dec("10"), OpenPrice: dec("100"), ClosePrice: dec("110"), Margin: dec("500"), Commission: dec("5")},
+			want{realizedPnl: "100", returnPct: "10", netPnl: "95", netReturnPct: "9.5", returnOnMargin: "20", netReturnOnMargin: "19"},
+		},
+		{
+			"exact cents",
+			Trade{Direction: TradeDirectionLong, Quantity: dec("3"), ExitedQuantity: dec("3"), OpenPrice: dec("0.1"), ClosePrice: dec("0.3"), Commission: dec("0.1")},
+			want{realizedPnl: "0.6", returnPct: "200", netPnl: "0.5", netReturnPct: "166.66666667", returnOnMargin: "0", netReturnOnMargin: "0"},
+		},
+		{
+			"R-multiple from the stop loss",
+			Trade{Direction: TradeDirectionLong, Quantity: dec("10"), ExitedQuantity: dec("10"), OpenPrice: dec("100"), ClosePrice: dec("110"), Commission: dec("5"), StopLoss: nullDec("95")},
+			want{realizedPnl: "100", returnPct: "10", netPnl: "95", netReturnPct: "9.5", returnOnMargin: "0", netReturnOnMargin: "0", rMultiple: "1.9"},
+		},
+		{
+			"R-multiple from the planned risk",
+			Trade{Direction: TradeDirectionShort, Quantity: dec("10"), ExitedQuantity: dec("10"), OpenPrice: dec("100"), ClosePrice: dec("104"), StopLoss: nullDec("105"), PlannedRisk: nullDec("80")},
+			want{realizedPnl: "-40", returnPct: "-4", netPnl: "-40", netReturnPct: "-4", returnOnMargin: "0", netReturnOnMargin: "0", rMultiple: "-0.5"},
+		},
+		{
+			"no R-multiple while nothing is closed",
+			Trade{Direction: TradeDirectionLong, Quantity: dec("10"), OpenPrice: dec("100"), StopLoss: nullDec("95")},
+			want{realizedPnl: "0", returnPct: "0", netPnl: "0", netReturnPct: "0", returnOnMargin: "0", netReturnOnMargin: "0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trade := tt.trade
+			trade.ComputePnl()
+			checks := []struct {
+				field string
+				got   decimal.Decimal
+				want  string
+			}{
+				{"RealizedPnl", trade.RealizedPnl, tt.want.realizedPnl},
+				{"ReturnPct", trade.ReturnPct, tt.want.returnPct},
+				{"NetPnl", trade.NetPnl, tt.want.netPnl},
+				{"NetReturnPct", trade.NetReturnPct, tt.want.netReturnPct},
+				{"ReturnOnMargin", trade.ReturnOnMargin, tt.want.returnOnMargin},
+				{"NetReturnOnMargin", trade.NetReturnOnMargin, tt.want.netReturnOnMargin},
+			}
+			for _, check := range checks {
+				if !check.got.Equal(dec(check.want)) {
+					t.Errorf("%s = %s, want %s", check.field, check.got, check.want)
+				}
+			}
+			if !equalNull(trade.Pips, tt.want.pips) {
+				t.Errorf("Pips = %v, want %q", trade.Pips, tt.want.pips)
+			}
+			if !equalNull(trade.RMultiple, tt.want.rMultiple) {
+				t.Errorf("RMultiple = %v, want %q", trade.RMultiple, tt.want.rMultiple)
+			}
+		})
+	}
+}
+
+func TestLiquidationPriceFor(t *testing.T) {
+	tests := []struct {
+		name       string
+		trade      Trade
+		collateral string
+		// want is rounded to cents, empty when the position cannot be
+		// liquidated
+		want string
+	}{
+		{"unleveraged", Trade{Direction: TradeDirectionLong, Quantity: dec("1"), OpenPrice: dec("100")}, "10", ""},
+		{"10x isolated long", Trade{Direction: TradeDirectionLong, Quantity: dec("1"), OpenPrice: dec("100"), Leverage: nullDec("10")}, "10", "90.45"},
+		{"10x isolated short", Trade{Direction: TradeDirectionShort, Quantity: dec("1"), OpenPrice: dec("100"), Leverage: nullDec("10")}, "10", "109.45"},
+		{"own maintenance rate", Trade{Direction: TradeDirectionShort, Quantity: dec("2"), OpenPrice: dec("50"), Leverage: nullDec("5"), MaintenanceMarginRate: nullDec("0.01")}, "20", "59.41"},
+		{"futures point value", Trade{Direction: TradeDirectionLong, Quantity: dec("1"), OpenPrice: dec("4000"), Multiplier: dec("50"), Leverage: nullDec("10"), MaintenanceMarginRate: nullDec("0")}, "20000", "3600"},
+		{"long backed by its full value", Trade{Direction: TradeDirectionLong, Quantity: dec("1"), OpenPrice: dec("100"), Leverage: nullDec("1")}, "100", ""},
+		{"long backed by more than its value", Trade{Direction: TradeDirectionLong, Quantity: dec("1"), OpenPrice: dec("100"), Leverage: nullDec("1")}, "150", ""},
+		{"no position", Trade{Direction: TradeDirectionLong, OpenPrice: dec("100"), Leverage: nullDec("10")}, "10", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.trade.LiquidationPriceFor(dec(tt.collateral))
+			if got.Valid {
+				got.Decimal = got.Decimal.Round(2)
+			}
+			if !equalNull(got, tt.want) {
+				t.Errorf("LiquidationPriceFor(%s) = %v, want %q", tt.collateral, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyExecutions(t *testing.T) {
+	openAt := time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC)
+	fill := func(side string, quantity string, price string, minutes int) Execution {
+		return Execution{Side: side, Quantity: dec(quantity), Price: dec(price), ExecutedAt: openAt.Add(time.Duration(minutes) * time.Minute)}
+	}
+	tests := []struct {
+		name        string
+		direction   string
+		executions  []Execution
+		status      string
+		quantity    string
+		exited      string
+		openPrice   string
+		closePrice  string
+		realizedPnl string
+	}{
+		{
+			"scaled in, still open",
+			TradeDirectionLong,
+			[]Execution{fill(ExecutionSideBuy, "10", "100", 0), fill(ExecutionSideBuy, "10", "110", 5)},
+			TradeStatusOpen, "20", "0", "105", "0", "0",
+		},
+		{
+			"partially scaled out",
+			TradeDirectionLong,
+			[]Execution{fill(ExecutionSideBuy, "10", "100", 0), fill(ExecutionSideBuy, "10", "110", 5), fill(ExecutionSideSell, "5", "120", 10)},
+			TradeStatusOpen, "20", "5", "105", "120", "75",
+		},
+		{
+			"scaled out completely",
+			TradeDirectionLong,
+			[]Execution{fill(ExecutionSideBuy, "10", "100", 0), fill(ExecutionSideSell, "4", "120", 10), fill(ExecutionSideSell, "6", "95", 20)},
+			TradeStatusClosed, "10", "10", "100", "105", "50",
+		},
+		{
+			"short given out of order",
+			TradeDirectionShort,
+			[]Execution{fill(ExecutionSideBuy, "3", "40", 30), fill(ExecutionSideSell, "3", "50", 0)},
+			TradeStatusClosed, "3", "3", "50", "40", "30",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trade := &Trade{Direction: tt.direction, Executions: tt.executions}
+			if err := trade.ApplyExecutions(); err != nil {
+				t.Fatalf("ApplyExecutions() error = %v", err)
+			}
+			if trade.Status != tt.status {
+				t.Errorf("Status = %q, want %q", trade.Status, tt.status)
+			}
+			if (trade.ClosePositionAt != nil) != (tt.status == TradeStatusClosed) {
+				t.Errorf("ClosePositionAt = %v with status %q", trade.ClosePositionAt, trade.Status)
+			}
+			if !trade.OpenPositionAt.Equal(openAt) {
+				t.Errorf("OpenPositionAt = %v, want the first execution at %v", trade.OpenPositionAt, openAt)
+			}
+			checks := []struct {
+				field string
+				got   decimal.Decimal
+				want  string
+			}{
+				{"Quantity", trade.Quantity, tt.quantity},
+				{"ExitedQuantity", trade.ExitedQuantity, tt.exited},
+				{"OpenPrice", trade.OpenPrice, tt.openPrice},
+				{"ClosePrice", trade.ClosePrice, tt.closePrice},
+				{"RealizedPnl", trade.RealizedPnl, tt.realizedPnl},
+			}
+			for _, check := range checks {
+				if !check.got.Equal(dec(check.want)) {
+					t.Errorf("%s = %s, want %s", check.field, check.got, check.want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyExecutionsRejectsOverfill(t *testing.T) {
+	openAt := time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC)
+	trade := &Trade{
+		Direction: TradeDirectionLong,
+		Executions: []Execution{
+			{Side: ExecutionSideBuy, Quantity: dec("5"), Price: dec("100"), ExecutedAt: openAt},
+			// The exit comes before the second entry, so the position
+			// would be short in between
+			{Side: ExecutionSideSell, Quantity: dec("8"), Price: dec("105"), ExecutedAt: openAt.Add(time.Minute)},
+			{Side: ExecutionSideBuy, Quantity: dec("5"), Price: dec("101"), ExecutedAt: openAt.Add(2 * time.Minute)},
+		},
+	}
+	if err := trade.ApplyExecutions(); !errors.Is(err, ErrExecutionOverfill) {
+		t.Errorf("ApplyExecutions() error = %v, want %v", err, ErrExecutionOverfill)
+	}
+}
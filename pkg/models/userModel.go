@@ -10,6 +10,14 @@ type User struct {
 	LastName string
 	FullName string
 	Email string `gorm:"unique"`
+	// Timezone is the IANA name of the zone time based analytics are
+	// evaluated in
+	Timezone string `gorm:"not null;default:UTC"`
 	ProfileUrl string
+	// ProfileKey is the object key of the uploaded profile picture and
+	// PendingProfileKey the key handed out for an upload not confirmed yet
+	ProfileKey string
+	PendingProfileKey string
 	Trades []Trade `gorm:"foreignKey:UserId;references:UserId"` 
+	Accounts []Account `gorm:"foreignKey:UserId;references:UserId"`
 }
@@ -20,7 +20,44 @@ var Mux = func() (*http.ServeMux){
 
 	// Protected routes
 	mux.Handle("/auth", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.AuthHandler)), []string{http.MethodGet}))
-	mux.Handle("/trade", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.AddTrade)), []string{http.MethodPost}))
-	mux.Handle("/profile", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.GetProfile)), []string{http.MethodGet}))
+	mux.Handle("/trade", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.TradeHandler)), []string{http.MethodGet, http.MethodPost}))
+	mux.Handle("/trade/{id}", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.TradeDetailHandler)), []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete}))
+	mux.Handle("/trade/{id}/close", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.CloseTrade)), []string{http.MethodPost}))
+	mux.Handle("/trade/{id}/executions", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.ExecutionsHandler)), []string{http.MethodGet, http.MethodPost}))
+	mux.Handle("/trade/{id}/executions/{executionId}", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.DeleteExecution)), []string{http.MethodDelete}))
+	mux.Handle("/trade/{id}/attachments", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.AttachmentsHandler)), []string{http.MethodGet, http.MethodPost}))
+	mux.Handle("/trade/{id}/attachments/{attachmentId}", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.AttachmentDetailHandler)), []string{http.MethodGet, http.MethodDelete}))
+	mux.Handle("/trade/{id}/attachments/{attachmentId}/confirm", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.ConfirmAttachment)), []string{http.MethodPost}))
+	mux.Handle("/trade/{id}/expire", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.ExpireOption)), []string{http.MethodPost}))
+	mux.Handle("/trade/{id}/roll", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.RollHandler)), []string{http.MethodPost, http.MethodDelete}))
+	mux.Handle("/trade/{id}/funding", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.FundingHandler)), []string{http.MethodGet, http.MethodPost}))
+	mux.Handle("/trade/{id}/funding/{paymentId}", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.DeleteFundingPayment)), []string{http.MethodDelete}))
+	mux.Handle("/account", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.AccountHandler)), []string{http.MethodGet, http.MethodPost}))
+	mux.Handle("/account/{id}", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.AccountDetailHandler)), []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete}))
+	mux.Handle("/account/{id}/ledger", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.LedgerHandler)), []string{http.MethodGet, http.MethodPost}))
+	mux.Handle("/account/{id}/ledger/{entryId}", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.DeleteLedgerEntry)), []string{http.MethodDelete}))
+	mux.Handle("/account/{id}/balance", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.GetAccountBalance)), []string{http.MethodGet}))
+	mux.Handle("/tag", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.TagHandler)), []string{http.MethodGet, http.MethodPost}))
+	mux.Handle("/tag/{id}", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.TagDetailHandler)), []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete}))
+	mux.Handle("/option-strategy", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.OptionStrategyHandler)), []string{http.MethodGet, http.MethodPost}))
+	mux.Handle("/option-strategy/{id}", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.OptionStrategyDetailHandler)), []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete}))
+	mux.Handle("/instrument", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.ListInstruments)), []string{http.MethodGet}))
+	mux.Handle("/instrument/{symbol}", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.GetInstrument)), []string{http.MethodGet}))
+	mux.Handle("/fx-rate", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.ListFxRates)), []string{http.MethodGet}))
+	mux.Handle("/note", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.NoteHandler)), []string{http.MethodGet, http.MethodPost}))
+	mux.Handle("/note/{id}", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.NoteDetailHandler)), []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete}))
+	mux.Handle("/note/{id}/history", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.GetNoteHistory)), []string{http.MethodGet}))
+	mux.Handle("/stats/summary", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.GetSummaryStats)), []string{http.MethodGet}))
+	mux.Handle("/stats/equity", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.GetEquityCurve)), []string{http.MethodGet}))
+	mux.Handle("/stats/time", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.GetTimeStats)), []string{http.MethodGet}))
+	mux.Handle("/stats/calendar", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.GetCalendarStats)), []string{http.MethodGet}))
+	mux.Handle("/stats/risk", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.GetRiskStats)), []string{http.MethodGet}))
+	mux.Handle("/stats/r", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.GetRStats)), []string{http.MethodGet}))
+	mux.Handle("/stats/tags", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.GetTagStats)), []string{http.MethodGet}))
+	mux.Handle("/stats/futures", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.GetFuturesStats)), []string{http.MethodGet}))
+	mux.Handle("/stats/psychology", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.GetPsychologyStats)), []string{http.MethodGet}))
+	mux.Handle("/profile", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.ProfileHandler)), []string{http.MethodGet, http.MethodPut, http.MethodPatch}))
+	mux.Handle("/profile/picture", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.ProfilePictureHandler)), []string{http.MethodPost, http.MethodDelete}))
+	mux.Handle("/profile/picture/confirm", middleware.MethodCheckMiddleware(middleware.AuthenticationMiddleware(http.HandlerFunc(controllers.ConfirmProfilePicture)), []string{http.MethodPost}))
 	return mux
 }
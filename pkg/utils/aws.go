@@ -61,6 +61,23 @@ func (c *CognitoAuth) AdminGetUser(username string) (*cognitoidentityprovider.Ad
 	return resp, err
 }
 
+// AdminUpdateUserAttributes sets the given attributes, keyed by their Cognito
+// name, on the user
+func (c *CognitoAuth) AdminUpdateUserAttributes(username string, attributes map[string]string) error {
+	client := cognitoidentityprovider.NewFromConfig(c.Cfg)
+	userAttributes := []types.AttributeType{}
+	for name, value := range attributes {
+		userAttributes = append(userAttributes, types.AttributeType{Name: aws.String(name), Value: aws.String(value)})
+	}
+	updateInput := &cognitoidentityprovider.AdminUpdateUserAttributesInput{
+		UserPoolId: &c.UserPoolID,
+		Username: &username,
+		UserAttributes: userAttributes,
+	}
+	_, err := client.AdminUpdateUserAttributes(context.TODO(), updateInput)
+	return err
+}
+
 func (c *CognitoAuth) ValidateToken(token string) (*cognitoidentityprovider.GetUserOutput, error) {
 	client := cognitoidentityprovider.NewFromConfig(c.Cfg)
 	getUserInputFields := &cognitoidentityprovider.GetUserInput{
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/abdullahelwalid/tradelog-go/pkg/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var DB *gorm.DB
@@ -21,9 +23,121 @@ func InitDB() {
 		log.Fatal("failed to connect to the database:", err)
 	}
 
-	err = DB.AutoMigrate(&models.User{}, &models.Trade{})
+	err = migrateMoneyColumns()
+	if err != nil {
+		log.Fatal("failed to migrate money columns:", err)
+	}
+
+	err = DB.AutoMigrate(&models.User{}, &models.Account{}, &models.Trade{}, &models.Execution{}, &models.LedgerEntry{}, &models.Tag{}, &models.Note{}, &models.NoteRevision{}, &models.Attachment{}, &models.Instrument{}, &models.InstrumentAlias{}, &models.OptionStrategy{}, &models.FundingPayment{}, &models.FxRate{}, &models.SchemaMigration{})
 	if err != nil {
 		log.Fatal("failed to migrate database schema:", err)
 	}
+
+	err = runDataMigrations()
+	if err != nil {
+		log.Fatal("failed to migrate data:", err)
+	}
+
+	err = seedInstruments()
+	if err != nil {
+		log.Fatal("failed to seed the instrument catalog:", err)
+	}
+
+	err = seedFxRates()
+	if err != nil {
+		log.Fatal("failed to seed the FX rate table:", err)
+	}
 }
 
+// migrateMoneyColumns converts the float4 money columns of trades to numeric.
+// AutoMigrate would cast float4 straight to numeric, which Postgres rounds to
+// 6 significant digits, so go through the shortest text representation that
+// round trips to the same float4 instead.
+func migrateMoneyColumns() error {
+	if !DB.Migrator().HasTable(&models.Trade{}) {
+		return nil
+	}
+	columnTypes, err := DB.Migrator().ColumnTypes(&models.Trade{})
+	if err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET LOCAL extra_float_digits = 3").Error; err != nil {
+			return err
+		}
+		for _, columnType := range columnTypes {
+			if columnType.DatabaseTypeName() != "float4" {
+				continue
+			}
+			err := tx.Exec("ALTER TABLE trades ALTER COLUMN ? TYPE numeric(38,18) USING ?::text::numeric(38,18)", gorm.Expr(tx.Statement.Quote(columnType.Name())), gorm.Expr(tx.Statement.Quote(columnType.Name()))).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// dataMigrations are the one-off data migrations, applied in order. Each
+// one is recorded in schema_migrations under its version once it has been
+// applied and is skipped from then on. New migrations go at the end.
+var dataMigrations = []struct {
+	version string
+	migrate func(tx *gorm.DB) error
+}{
+	{"0001_backfill_trade_sizes", backfillTradeSizes},
+}
+
+// runDataMigrations applies the data migrations that have not been applied
+// yet, each in its own transaction together with its record
+func runDataMigrations() error {
+	for _, migration := range dataMigrations {
+		var count int64
+		if err := DB.Model(&models.SchemaMigration{}).Where("version = ?", migration.version).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := migration.migrate(tx); err != nil {
+				return err
+			}
+			return tx.Create(&models.SchemaMigration{Version: migration.version, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", migration.version, err)
+		}
+		log.Printf("applied data migration %s", migration.version)
+	}
+	return nil
+}
+
+// backfillTradeSizes fills in the exited quantity of closed trades logged
+// before it existed and computes the net P&L of trades logged before it
+// existed. Trades logged before quantity existed only have a margin, which
+// says nothing about their size, so they keep a quantity of 0 and no P&L
+// until they are edited.
+func backfillTradeSizes(tx *gorm.DB) error {
+	// Closed trades logged before exited quantity existed were closed in full
+	result := tx.Model(&models.Trade{}).Where("status = ? AND exited_quantity = 0", models.TradeStatusClosed).Update("exited_quantity", gorm.Expr("quantity"))
+	if result.Error != nil {
+		return result.Error
+	}
+
+	// Trades logged before quantity existed used the margin as the position
+	// value, derive the matching quantity and recompute their P&L. Trades
+	// logged before net P&L existed only need the recompute.
+	var trades []models.Trade
+	result = tx.Where("exited_quantity > 0").Find(&trades)
+	if result.Error != nil {
+		return result.Error
+	}
+	for i := range trades {
+		trades[i].ComputePnl()
+		if err := tx.Omit(clause.Associations).Save(&trades[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/glebarez/sqlite"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRunDataMigrations(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:TestRunDataMigrations?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("opening the test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Trade{}, &models.SchemaMigration{}); err != nil {
+		t.Fatalf("migrating the test database: %v", err)
+	}
+	previous := DB
+	DB = db
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+		DB = previous
+	})
+
+	// Closed trades logged before exited quantity existed, one of them
+	// also before quantity existed
+	closedAt := time.Date(2024, 3, 5, 15, 0, 0, 0, time.UTC)
+	trades := []models.Trade{
+		{TradId: "trade-1", UserId: "alice", Asset: "AAPL", Status: models.TradeStatusClosed, Quantity: decimal.NewFromInt(10), OpenPositionAt: closedAt.Add(-time.Hour), ClosePositionAt: &closedAt, Margin: decimal.NewFromInt(1000), OpenPrice: decimal.NewFromInt(100), ClosePrice: decimal.NewFromInt(110)},
+		{TradId: "trade-2", UserId: "alice", Asset: "AAPL", Status: models.TradeStatusClosed, OpenPositionAt: closedAt.Add(-time.Hour), ClosePositionAt: &closedAt, Margin: decimal.NewFromInt(1000), OpenPrice: decimal.NewFromInt(100), ClosePrice: decimal.NewFromInt(110)},
+	}
+	if err := db.Create(&trades).Error; err != nil {
+		t.Fatalf("creating trades: %v", err)
+	}
+
+	if err := runDataMigrations(); err != nil {
+		t.Fatalf("runDataMigrations() error = %v", err)
+	}
+	tests := []struct {
+		tradeId     string
+		exited      int64
+		realizedPnl int64
+	}{
+		{"trade-1", 10, 100},
+		{"trade-2", 0, 0},
+	}
+	for _, tt := range tests {
+		var trade models.Trade
+		if err := db.Where("trad_id = ?", tt.tradeId).First(&trade).Error; err != nil {
+			t.Fatalf("loading %s: %v", tt.tradeId, err)
+		}
+		if !trade.ExitedQuantity.Equal(decimal.NewFromInt(tt.exited)) || !trade.RealizedPnl.Equal(decimal.NewFromInt(tt.realizedPnl)) {
+			t.Errorf("%s = exited %s for %s, want %d for %d", tt.tradeId, trade.ExitedQuantity, trade.RealizedPnl, tt.exited, tt.realizedPnl)
+		}
+	}
+
+	// Applied migrations are recorded and never run again
+	if err := db.Model(&models.Trade{}).Where("trad_id = ?", "trade-1").Update("realized_pnl", 0).Error; err != nil {
+		t.Fatalf("resetting trade: %v", err)
+	}
+	if err := runDataMigrations(); err != nil {
+		t.Fatalf("runDataMigrations() error = %v", err)
+	}
+	var count int64
+	db.Model(&models.SchemaMigration{}).Count(&count)
+	if count != int64(len(dataMigrations)) {
+		t.Errorf("%d migrations recorded, want %d", count, len(dataMigrations))
+	}
+	var trade models.Trade
+	if err := db.Where("trad_id = ?", "trade-1").First(&trade).Error; err != nil {
+		t.Fatalf("loading trade-1: %v", err)
+	}
+	if !trade.RealizedPnl.IsZero() {
+		t.Errorf("RealizedPnl = %s after the second run, want the migration skipped", trade.RealizedPnl)
+	}
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm/clause"
+)
+
+// defaultFxRateTable is the rate table seeded when FX_RATES is not set,
+// relative to the working directory of the server
+const defaultFxRateTable = "data/fx_rates.json"
+
+// fxRateEntry is a rate as written in the rate table file
+type fxRateEntry struct {
+	Base  string          `json:"base"`
+	Quote string          `json:"quote"`
+	AsOf  string          `json:"asOf"`
+	Rate  decimal.Decimal `json:"rate"`
+}
+
+// seedFxRates loads the FX rate table file into the database. Rates are
+// matched on their pair and day, so the file can be extended with new days
+// and seeded again.
+func seedFxRates() error {
+	path := os.Getenv("FX_RATES")
+	if path == "" {
+		path = defaultFxRateTable
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("FX rate table %s not found, skipping seed", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var entries []fxRateEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	rates := make([]models.FxRate, 0, len(entries))
+	for _, entry := range entries {
+		asOf, err := time.Parse(time.DateOnly, entry.AsOf)
+		if err != nil {
+			return err
+		}
+		if !entry.Rate.IsPositive() {
+			return errors.New("FX rate table entry without a positive rate")
+		}
+		rates = append(rates, models.FxRate{
+			BaseCurrency:  strings.ToUpper(entry.Base),
+			QuoteCurrency: strings.ToUpper(entry.Quote),
+			AsOf:          asOf,
+			Rate:          entry.Rate,
+		})
+	}
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base_currency"}, {Name: "quote_currency"}, {Name: "as_of"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at", "deleted_at"}),
+	}).Create(&rates).Error
+}
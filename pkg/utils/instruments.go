@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultInstrumentCatalog is the catalog seeded when INSTRUMENT_CATALOG is
+// not set, relative to the working directory of the server
+const defaultInstrumentCatalog = "data/instruments.json"
+
+// catalogEntry is an instrument as written in the catalog file
+type catalogEntry struct {
+	Symbol             string              `json:"symbol"`
+	Name               string              `json:"name"`
+	AssetClass         string              `json:"assetClass"`
+	Exchange           string              `json:"exchange"`
+	QuoteCurrency      string              `json:"quoteCurrency"`
+	TickSize           decimal.Decimal     `json:"tickSize"`
+	ContractMultiplier decimal.NullDecimal `json:"contractMultiplier"`
+	PipSize            decimal.NullDecimal `json:"pipSize"`
+	ContractMonths     string              `json:"contractMonths"`
+	Aliases            []string            `json:"aliases"`
+}
+
+// seedInstruments loads the instrument catalog file into the database.
+// Instruments are matched on their symbol, so the file can be edited and
+// seeded again; aliases are only ever added or moved, never removed.
+func seedInstruments() error {
+	path := os.Getenv("INSTRUMENT_CATALOG")
+	if path == "" {
+		path = defaultInstrumentCatalog
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("instrument catalog %s not found, skipping seed", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var entries []catalogEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return err
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, entry := range entries {
+			symbol := models.NormalizeSymbol(entry.Symbol)
+			if symbol == "" {
+				return errors.New("instrument catalog entry without a symbol")
+			}
+			multiplier := decimal.NewFromInt(1)
+			if entry.ContractMultiplier.Valid {
+				multiplier = entry.ContractMultiplier.Decimal
+			}
+			instrument := &models.Instrument{
+				Symbol:             symbol,
+				Name:               entry.Name,
+				AssetClass:         entry.AssetClass,
+				Exchange:           entry.Exchange,
+				QuoteCurrency:      entry.QuoteCurrency,
+				TickSize:           entry.TickSize,
+				ContractMultiplier: multiplier,
+				PipSize:            entry.PipSize,
+				ContractMonths:     entry.ContractMonths,
+			}
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "symbol"}},
+				DoUpdates: clause.AssignmentColumns([]string{"name", "asset_class", "exchange", "quote_currency", "tick_size", "contract_multiplier", "pip_size", "contract_months", "updated_at", "deleted_at"}),
+			}).Create(instrument).Error
+			if err != nil {
+				return err
+			}
+
+			// The symbol is always an alias of itself
+			aliases := []models.InstrumentAlias{{Alias: symbol, Symbol: symbol}}
+			seen := map[string]bool{symbol: true}
+			for _, alias := range entry.Aliases {
+				// Several spellings often normalize to the same alias
+				normalized := models.NormalizeSymbol(alias)
+				if normalized == "" || seen[normalized] {
+					continue
+				}
+				seen[normalized] = true
+				aliases = append(aliases, models.InstrumentAlias{Alias: normalized, Symbol: symbol})
+			}
+			err = tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "alias"}},
+				DoUpdates: clause.AssignmentColumns([]string{"symbol", "updated_at", "deleted_at"}),
+			}).Create(&aliases).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		// Point trades logged before the catalog knew their instrument at it
+		return tx.Exec(`UPDATE trades SET asset = instrument_aliases.symbol
+			FROM instrument_aliases
+			WHERE instrument_aliases.alias = upper(regexp_replace(trades.asset, '[^[:alnum:]]', '', 'g'))
+			AND instrument_aliases.deleted_at IS NULL
+			AND trades.asset <> instrument_aliases.symbol`).Error
+	})
+}
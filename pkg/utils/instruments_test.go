@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/abdullahelwalid/tradelog-go/pkg/models"
+)
+
+// TestInstrumentCatalog checks the shipped catalog seeds without conflicts:
+// every instrument has a symbol and no spelling is an alias of two of them
+func TestInstrumentCatalog(t *testing.T) {
+	content, err := os.ReadFile("../../" + defaultInstrumentCatalog)
+	if err != nil {
+		t.Fatalf("reading the catalog: %v", err)
+	}
+	var entries []catalogEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		t.Fatalf("parsing the catalog: %v", err)
+	}
+
+	owners := map[string]string{}
+	for _, entry := range entries {
+		symbol := models.NormalizeSymbol(entry.Symbol)
+		if symbol == "" || symbol != entry.Symbol {
+			t.Errorf("symbol %q is not normalized", entry.Symbol)
+		}
+		for _, alias := range append([]string{entry.Symbol}, entry.Aliases...) {
+			normalized := models.NormalizeSymbol(alias)
+			if owner, ok := owners[normalized]; ok && owner != symbol {
+				t.Errorf("alias %q of %s is already an alias of %s", alias, symbol, owner)
+			}
+			owners[normalized] = symbol
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"bytes"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// notePolicy allows the markup users write in notes and strips anything
+// that could run script in the browser rendering it
+var notePolicy = bluemonday.UGCPolicy()
+
+// RenderMarkdown converts Markdown to sanitized HTML. Raw HTML in the source
+// is dropped by goldmark and whatever it produces is sanitized again, so the
+// result is safe to insert into a page as is.
+func RenderMarkdown(source string) string {
+	var buf bytes.Buffer
+	// Convert only fails when writing to the buffer fails, which a
+	// bytes.Buffer never does
+	markdown.Convert([]byte(source), &buf)
+	return notePolicy.Sanitize(buf.String())
+}
@@ -0,0 +1,23 @@
+package utils
+
+import "testing"
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"emphasis", "Cut the *loser* fast", "<p>Cut the <em>loser</em> fast</p>\n"},
+		{"table", "| a |\n| - |\n| 1 |", "<table>\n<thead>\n<tr>\n<th>a</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td>1</td>\n</tr>\n</tbody>\n</table>\n"},
+		{"raw script", "<script>alert(1)</script>", "\n"},
+		{"script link", "[chart](javascript:alert(1))", "<p>chart</p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderMarkdown(tt.source); got != tt.want {
+				t.Errorf("RenderMarkdown(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
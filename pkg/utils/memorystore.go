@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MemoryStore is an ObjectStore keeping objects in memory. It stands in for
+// S3 in tests and local runs: its presigned URLs cannot be uploaded to, so
+// objects are stored with Put instead.
+type MemoryStore struct {
+	mu      sync.Mutex
+	objects map[string]ObjectInfo
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{objects: map[string]ObjectInfo{}}
+}
+
+// memoryURL builds the URL handed out for an object of the store
+func memoryURL(method string, bucketName string, objectKey string, lifetimeSecs int64) string {
+	return fmt.Sprintf("memory://%s/%s?method=%s&expires=%d", bucketName, objectKey, method, lifetimeSecs)
+}
+
+// Put stores an object as a client uploading to the presigned URL would
+func (store *MemoryStore) Put(bucketName string, objectKey string, info ObjectInfo) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.objects[bucketName+"/"+objectKey] = info
+}
+
+// Keys returns the keys of the objects stored in the bucket
+func (store *MemoryStore) Keys(bucketName string) []string {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	keys := make([]string, 0, len(store.objects))
+	for key := range store.objects {
+		if objectKey, ok := strings.CutPrefix(key, bucketName+"/"); ok {
+			keys = append(keys, objectKey)
+		}
+	}
+	return keys
+}
+
+func (store *MemoryStore) GeneratePutURL(ctx context.Context, bucketName string, objectKey string, lifetimeSecs int64) (string, error) {
+	return memoryURL("PUT", bucketName, objectKey, lifetimeSecs), nil
+}
+
+func (store *MemoryStore) GenerateGetURL(ctx context.Context, bucketName string, objectKey string, lifetimeSecs int64) (string, error) {
+	return memoryURL("GET", bucketName, objectKey, lifetimeSecs), nil
+}
+
+func (store *MemoryStore) HeadObject(ctx context.Context, bucketName string, objectKey string) (*ObjectInfo, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	info, ok := store.objects[bucketName+"/"+objectKey]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return &info, nil
+}
+
+// DeleteObject removes the object, succeeding like S3 when there is none
+func (store *MemoryStore) DeleteObject(ctx context.Context, bucketName string, objectKey string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.objects, bucketName+"/"+objectKey)
+	return nil
+}
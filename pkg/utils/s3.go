@@ -2,12 +2,42 @@ package utils
 
 import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
 	"context"
+	"errors"
 	"log"
+	"os"
 	"time"
 )
 
+// ErrObjectNotFound is returned by ObjectStore.HeadObject when nothing has
+// been stored under the key
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo describes an object that has been stored
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+}
+
+// ObjectStore is the object storage used for user uploads. Clients upload and
+// download through presigned URLs, the server only ever inspects and deletes
+// objects. S3Store is the implementation used in production, anything
+// speaking the same interface can stand in for it locally.
+type ObjectStore interface {
+	GeneratePutURL(ctx context.Context, bucketName string, objectKey string, lifetimeSecs int64) (string, error)
+	GenerateGetURL(ctx context.Context, bucketName string, objectKey string, lifetimeSecs int64) (string, error)
+	HeadObject(ctx context.Context, bucketName string, objectKey string) (*ObjectInfo, error)
+	DeleteObject(ctx context.Context, bucketName string, objectKey string) error
+}
+
+// Storage is the object store used by the controllers and StorageBucket the
+// bucket uploads go to. Both are set by InitStorage.
+var Storage ObjectStore
+var StorageBucket string
+
 type S3Presign struct {
 	PresignClient *s3.PresignClient
 }
@@ -27,3 +57,64 @@ func (presigner S3Presign) GeneratePutURL(ctx context.Context, bucketName string
 	}
 	return request.URL, nil
 }
+
+func (presigner S3Presign) GenerateGetURL(ctx context.Context, bucketName string, objectKey string, lifetimeSecs int64) (string, error) {
+	request, err := presigner.PresignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	}, func(opts *s3.PresignOptions) {
+		opts.Expires = time.Duration(lifetimeSecs * int64(time.Second))
+	})
+	if err != nil {
+		log.Printf("Couldn't get a presigned request to get %v:%v. Here's why: %v\n",
+			bucketName, objectKey, err)
+		return "", err
+	}
+	return request.URL, nil
+}
+
+// S3Store is the ObjectStore backed by S3
+type S3Store struct {
+	S3Presign
+	Client *s3.Client
+}
+
+func (store S3Store) HeadObject(ctx context.Context, bucketName string, objectKey string) (*ObjectInfo, error) {
+	resp, err := store.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return &ObjectInfo{Size: aws.ToInt64(resp.ContentLength), ContentType: aws.ToString(resp.ContentType)}, nil
+}
+
+func (store S3Store) DeleteObject(ctx context.Context, bucketName string, objectKey string) error {
+	_, err := store.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	})
+	return err
+}
+
+// InitStorage sets up the S3 object store from the environment. S3_ENDPOINT
+// points it at an S3 compatible server such as MinIO instead of AWS.
+func InitStorage() {
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Fatal(err)
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	Storage = S3Store{S3Presign: S3Presign{PresignClient: s3.NewPresignClient(client)}, Client: client}
+	StorageBucket = os.Getenv("S3_BUCKET")
+}